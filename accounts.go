@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sessionLifetime is how long a login lasts before the user must sign in again.
+const sessionLifetime = 14 * 24 * time.Hour
+
+var (
+	// ErrAccountNotFound is returned when no account has the requested username.
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrAccountExists is returned when creating an account whose username is taken.
+	ErrAccountExists = errors.New("an account with that username already exists")
+	// ErrBadCredentials is returned when a username and password do not match.
+	ErrBadCredentials = errors.New("invalid username or password")
+	// ErrLastAdmin is returned when a change would leave no admin account.
+	ErrLastAdmin = errors.New("there must be at least one admin")
+	// ErrSetupDone is returned when creating the first account once any
+	// account exists.
+	ErrSetupDone = errors.New("this installation is already set up")
+)
+
+// Account is a login for someone in the People registry.
+type Account struct {
+	Username     string    `json:"username"`
+	PersonID     PersonID  `json:"person_id"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Session is a signed-in browser or client. Only a hash of the session
+// token is kept, so a copy of the store cannot be used to log in.
+type Session struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CSRFToken string    `json:"csrf_token"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AccountStore holds user accounts and their sessions.
+type AccountStore struct {
+	mu       sync.RWMutex
+	store    Store
+	accounts []Account
+	sessions []Session
+}
+
+// accounts holds the user accounts and sessions
+var accounts *AccountStore
+
+// dummyHash is compared against when a username does not exist, so a
+// failed login takes as long whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// NewAccountStore loads accounts and sessions from store.
+func NewAccountStore(store Store) (*AccountStore, error) {
+	a := &AccountStore{store: store, accounts: []Account{}, sessions: []Session{}}
+	if _, err := store.Load("accounts", &a.accounts); err != nil {
+		return nil, err
+	}
+	if _, err := store.Load("sessions", &a.sessions); err != nil {
+		return nil, err
+	}
+
+	// Accounts created before roles existed become members, except the
+	// first one, which set up the installation and becomes its admin.
+	migrated := false
+	for i := range a.accounts {
+		if a.accounts[i].Role == "" {
+			a.accounts[i].Role = RoleMember
+			if i == 0 {
+				a.accounts[i].Role = RoleAdmin
+			}
+			migrated = true
+		}
+	}
+	if migrated {
+		if err := a.store.Save("accounts", a.accounts); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// commitAccounts saves the accounts before a new login, password or role
+// takes effect. Callers must hold a.mu for writing.
+func (a *AccountStore) commitAccounts(list []Account) error {
+	if err := a.store.Save("accounts", list); err != nil {
+		return err
+	}
+	a.accounts = list
+	return nil
+}
+
+// commitSessions saves the sessions so sign-ins survive a restart; a
+// session is only valid once it is stored. Callers must hold a.mu for
+// writing.
+func (a *AccountStore) commitSessions(list []Session) error {
+	if err := a.store.Save("sessions", list); err != nil {
+		return err
+	}
+	a.sessions = list
+	return nil
+}
+
+// index returns the position of an account, or -1.
+// Callers must hold a.mu.
+func (a *AccountStore) index(username string) int {
+	username = strings.ToLower(username)
+	for i, account := range a.accounts {
+		if account.Username == username {
+			return i
+		}
+	}
+	return -1
+}
+
+// Empty reports whether no accounts have been created yet.
+func (a *AccountStore) Empty() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.accounts) == 0
+}
+
+// List returns every account.
+func (a *AccountStore) List() []Account {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Account{}, a.accounts...)
+}
+
+// Get returns the account with the given username.
+func (a *AccountStore) Get(username string) (Account, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	i := a.index(username)
+	if i < 0 {
+		return Account{}, ErrAccountNotFound
+	}
+	return a.accounts[i], nil
+}
+
+// Create adds an account for a person with the given password and role.
+func (a *AccountStore) Create(username, password string, personID PersonID, role Role) (Account, error) {
+	return a.create(username, password, personID, role, false)
+}
+
+// CreateFirst adds the first account of a new installation, as an admin.
+// It returns ErrSetupDone if an account exists by the time it is stored.
+func (a *AccountStore) CreateFirst(username, password string, personID PersonID) (Account, error) {
+	return a.create(username, password, personID, RoleAdmin, true)
+}
+
+// create adds an account; with first set, only if there are none yet.
+func (a *AccountStore) create(username, password string, personID PersonID, role Role, first bool) (Account, error) {
+	if err := validateAccount(username, password); err != nil {
+		return Account{}, err
+	}
+	if err := validateRole(role); err != nil {
+		return Account{}, err
+	}
+	if _, err := people.Get(personID); err != nil {
+		return Account{}, &ValidationError{Fields: []FieldError{{Field: "person_id", Message: "unknown person " + string(personID)}}}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Account{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if first && len(a.accounts) > 0 {
+		return Account{}, ErrSetupDone
+	}
+	if a.index(username) >= 0 {
+		return Account{}, ErrAccountExists
+	}
+	account := Account{
+		Username:     strings.ToLower(username),
+		PersonID:     personID,
+		Role:         role,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	}
+	if err := a.commitAccounts(append(append([]Account{}, a.accounts...), account)); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+// Authenticate checks a username and password.
+func (a *AccountStore) Authenticate(username, password string) (Account, error) {
+	account, err := a.Get(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Account{}, ErrBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return Account{}, ErrBadCredentials
+	}
+	return account, nil
+}
+
+// SetPassword replaces an account's password after checking the current one.
+// Every session of the account is ended.
+func (a *AccountStore) SetPassword(username, current, password string) error {
+	if _, err := a.Authenticate(username, current); err != nil {
+		return err
+	}
+	if err := validateAccount(username, password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.index(username)
+	if i < 0 {
+		return ErrAccountNotFound
+	}
+	list := append([]Account{}, a.accounts...)
+	list[i].PasswordHash = string(hash)
+	if err := a.commitAccounts(list); err != nil {
+		return err
+	}
+
+	sessions := []Session{}
+	for _, s := range a.sessions {
+		if s.Username != list[i].Username {
+			sessions = append(sessions, s)
+		}
+	}
+	return a.commitSessions(sessions)
+}
+
+// SetRole changes the role of an account. The last admin cannot be demoted.
+func (a *AccountStore) SetRole(username string, role Role) (Account, error) {
+	if err := validateRole(role); err != nil {
+		return Account{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.index(username)
+	if i < 0 {
+		return Account{}, ErrAccountNotFound
+	}
+	if a.accounts[i].Role == RoleAdmin && role != RoleAdmin {
+		admins := 0
+		for _, account := range a.accounts {
+			if account.Role == RoleAdmin {
+				admins++
+			}
+		}
+		if admins == 1 {
+			return Account{}, ErrLastAdmin
+		}
+	}
+	list := append([]Account{}, a.accounts...)
+	list[i].Role = role
+	if err := a.commitAccounts(list); err != nil {
+		return Account{}, err
+	}
+	return list[i], nil
+}
+
+// StartSession signs an account in. It returns the token for the session
+// cookie; expired sessions are dropped at the same time.
+func (a *AccountStore) StartSession(username string) (string, Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", Session{}, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.index(username)
+	if i < 0 {
+		return "", Session{}, ErrAccountNotFound
+	}
+	now := time.Now()
+	session := Session{
+		ID:        hashToken(token),
+		Username:  a.accounts[i].Username,
+		CSRFToken: csrf,
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionLifetime),
+	}
+
+	sessions := []Session{}
+	for _, s := range a.sessions {
+		if s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	if err := a.commitSessions(append(sessions, session)); err != nil {
+		return "", Session{}, err
+	}
+	return token, session, nil
+}
+
+// Session returns the live session for a cookie token and its account.
+func (a *AccountStore) Session(token string) (Session, Account, bool) {
+	if token == "" {
+		return Session{}, Account{}, false
+	}
+	id := hashToken(token)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, s := range a.sessions {
+		if s.ID != id || !s.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		if i := a.index(s.Username); i >= 0 {
+			return s, a.accounts[i], true
+		}
+	}
+	return Session{}, Account{}, false
+}
+
+// EndSession signs out the session with the given cookie token.
+func (a *AccountStore) EndSession(token string) error {
+	id := hashToken(token)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sessions := []Session{}
+	for _, s := range a.sessions {
+		if s.ID != id {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == len(a.sessions) {
+		return nil
+	}
+	return a.commitSessions(sessions)
+}
+
+// randomToken returns 32 random bytes, base64url encoded.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how session tokens are stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCreateFirstOnlyOnce(t *testing.T) {
+	newTestStore(t)
+	ana := addPerson(t, "Ana", "")
+
+	// Several setup forms submitted at once: one wins, the rest are told
+	// setup is done
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = accounts.CreateFirst(fmt.Sprintf("admin%d", i), "secretpass1", ana.ID)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrSetupDone):
+			t.Errorf("CreateFirst: %v", err)
+		}
+	}
+	if list := accounts.List(); created != 1 || len(list) != 1 || list[0].Role != RoleAdmin {
+		t.Errorf("%d of 5 setups succeeded, leaving %+v; want one admin", created, list)
+	}
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionCookie holds the session token of a signed-in browser.
+	sessionCookie = "liz_session"
+	// formCSRFCookie protects the login and setup forms, which are used
+	// before there is a session to hold a CSRF token.
+	formCSRFCookie = "liz_form_csrf"
+	// csrfHeader must carry the session's CSRF token on every request that
+	// changes data.
+	csrfHeader = "X-CSRF-Token"
+)
+
+type accountKey struct{}
+
+// withAccount returns a context for a request made by account. The
+// person's name is used as the actor in history and comments.
+func withAccount(ctx context.Context, account Account) context.Context {
+	actor := account.Username
+	if p, err := people.Get(account.PersonID); err == nil {
+		actor = p.Name
+	}
+	return withActor(context.WithValue(ctx, accountKey{}, account), actor)
+}
+
+// accountFrom returns the account making a request, if it is signed in.
+func accountFrom(ctx context.Context) (Account, bool) {
+	account, ok := ctx.Value(accountKey{}).(Account)
+	return account, ok
+}
+
+// currentSession returns the session of the request's cookie, if it is valid.
+func currentSession(r *http.Request) (Session, Account, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return Session{}, Account{}, false
+	}
+	return accounts.Session(cookie.Value)
+}
+
+// requireLogin rejects requests without a valid session or API token, and
+// requests that change data without the session's CSRF token or with a
+// read-only token.
+func requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// API tokens are sent explicitly by scripts, never by a browser on
+		// its own, so they need no CSRF token.
+		if secret, ok := bearerToken(r); ok {
+			token, account, ok := tokens.Authenticate(secret)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "Invalid or expired API token")
+				return
+			}
+			if token.Scope == ScopeRead && !safeMethod(r.Method) {
+				writeError(w, http.StatusForbidden, ErrTokenReadOnly.Error())
+				return
+			}
+			next(w, r.WithContext(withAccount(r.Context(), account)))
+			return
+		}
+
+		session, account, ok := currentSession(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Login required")
+			return
+		}
+		if !safeMethod(r.Method) && !tokensMatch(r.Header.Get(csrfHeader), session.CSRFToken) {
+			writeError(w, http.StatusForbidden, "Missing or invalid CSRF token")
+			return
+		}
+		next(w, r.WithContext(withAccount(r.Context(), account)))
+	}
+}
+
+// safeMethod reports whether a request method only reads data.
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+func tokensMatch(got, want string) bool {
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionView is what the API tells a client about its own session.
+type sessionView struct {
+	Username    string       `json:"username"`
+	PersonID    PersonID     `json:"person_id"`
+	Name        string       `json:"name"`
+	Role        Role         `json:"role"`
+	Permissions []Permission `json:"permissions"`
+	CSRFToken   string       `json:"csrf_token"`
+}
+
+func newSessionView(session Session, account Account) sessionView {
+	return sessionView{
+		Username:    account.Username,
+		PersonID:    account.PersonID,
+		Name:        actorFrom(withAccount(context.Background(), account)),
+		Role:        account.Role,
+		Permissions: account.Role.Permissions(),
+		CSRFToken:   session.CSRFToken,
+	}
+}
+
+// accountView is an account without its password hash.
+type accountView struct {
+	Username  string    `json:"username"`
+	PersonID  PersonID  `json:"person_id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAccountView(account Account) accountView {
+	return accountView{
+		Username:  account.Username,
+		PersonID:  account.PersonID,
+		Name:      actorFrom(withAccount(context.Background(), account)),
+		Role:      account.Role,
+		CreatedAt: account.CreatedAt,
+	}
+}
+
+// sessionHandler serves /api/session: GET returns the signed-in account and
+// its CSRF token, POST signs in with a JSON username and password, and
+// DELETE signs out. Requests made with an API token have no session to end.
+func sessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		session, account, ok := currentSession(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Login required")
+			return
+		}
+		json.NewEncoder(w).Encode(newSessionView(session, account))
+
+	case "POST":
+		// Only JSON is accepted, so a form on another site cannot sign the
+		// browser in to an account of the attacker's choosing.
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		var login struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		session, account, err := signIn(w, r, login.Username, login.Password)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(newSessionView(session, account))
+
+	case "DELETE":
+		requireLogin(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(sessionCookie)
+			if _, bearer := bearerToken(r); bearer || err != nil {
+				writeError(w, http.StatusBadRequest, "API tokens have no session to sign out of; revoke the token instead")
+				return
+			}
+			if err := accounts.EndSession(cookie.Value); err != nil {
+				writeAccountError(w, err)
+				return
+			}
+			clearSessionCookie(w, r)
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+
+	default:
+		methodNotAllowed(w, r, "GET", "POST", "DELETE")
+	}
+}
+
+// signIn checks a username and password and starts a session cookie.
+func signIn(w http.ResponseWriter, r *http.Request, username, password string) (Session, Account, error) {
+	account, err := accounts.Authenticate(strings.TrimSpace(username), password)
+	if err != nil {
+		return Session{}, Account{}, err
+	}
+	token, session, err := accounts.StartSession(account.Username)
+	if err != nil {
+		return Session{}, Account{}, err
+	}
+	setSessionCookie(w, r, token, session.ExpiresAt)
+	return session, account, nil
+}
+
+// accountsHandler serves /api/accounts, /api/accounts/{username} and
+// /api/accounts/{username}/password. Adding accounts and changing roles is
+// for admins.
+func accountsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/accounts"), "/")
+	username, sub, _ := strings.Cut(path, "/")
+
+	switch {
+	case username == "":
+		switch r.Method {
+		case "GET":
+			views := []accountView{}
+			for _, account := range accounts.List() {
+				views = append(views, newAccountView(account))
+			}
+			json.NewEncoder(w).Encode(views)
+
+		case "POST":
+			if !requirePermission(w, r, PermManageAccounts) {
+				return
+			}
+			body := struct {
+				Username string   `json:"username"`
+				Password string   `json:"password"`
+				PersonID PersonID `json:"person_id"`
+				Name     string   `json:"name"`
+				Role     Role     `json:"role"`
+			}{Role: RoleMember}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			account, err := createAccount(body.Username, body.Password, body.PersonID, body.Name, body.Role)
+			if err != nil {
+				writeAccountError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(newAccountView(account))
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+
+	case sub == "":
+		switch r.Method {
+		case "GET":
+			account, err := accounts.Get(username)
+			if err != nil {
+				writeAccountError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(newAccountView(account))
+
+		case "PUT":
+			if !requirePermission(w, r, PermManageAccounts) {
+				return
+			}
+			var body struct {
+				Role Role `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			account, err := accounts.SetRole(username, body.Role)
+			if err != nil {
+				writeAccountError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(newAccountView(account))
+
+		default:
+			methodNotAllowed(w, r, "GET", "PUT")
+		}
+
+	case sub == "password":
+		if r.Method != "PUT" {
+			methodNotAllowed(w, r, "PUT")
+			return
+		}
+		if me, _ := accountFrom(r.Context()); me.Username != strings.ToLower(username) {
+			writeError(w, http.StatusForbidden, "You can only change your own password")
+			return
+		}
+		var body struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		if err := accounts.SetPassword(username, body.CurrentPassword, body.NewPassword); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		clearSessionCookie(w, r)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// createAccount adds an account for an existing person, or for a person
+// found or added by name.
+func createAccount(username, password string, personID PersonID, name string, role Role) (Account, error) {
+	return withAccountPerson(personID, name, func(personID PersonID) (Account, error) {
+		return accounts.Create(username, password, personID, role)
+	})
+}
+
+// withAccountPerson calls create with personID, or if it is empty the ID of
+// the person called name, adding them to People if there is none. Someone
+// added for an account that could not be made is removed again.
+func withAccountPerson(personID PersonID, name string, create func(PersonID) (Account, error)) (Account, error) {
+	personID, added, err := accountPerson(personID, name)
+	if err != nil {
+		return Account{}, err
+	}
+	account, err := create(personID)
+	if err != nil && added {
+		if err := taskManager.DeletePerson(personID); err != nil {
+			log.Printf("accounts: removing %s after the account failed: %v", personID, err)
+		}
+	}
+	return account, err
+}
+
+// accountPerson returns personID, or if it is empty the ID of the person
+// called name, adding them to People if there is none. It reports whether
+// it added them.
+func accountPerson(personID PersonID, name string) (PersonID, bool, error) {
+	if personID != "" {
+		return personID, false, nil
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", false, &ValidationError{Fields: []FieldError{{Field: "person_id", Message: "person_id or name is required"}}}
+	}
+	if p, ok := people.Lookup(name); ok {
+		return p.ID, false, nil
+	}
+	if err := validatePerson(Person{Name: name}); err != nil {
+		return "", false, err
+	}
+	p, err := people.Create(Person{Name: name})
+	if err != nil {
+		return "", false, err
+	}
+	return p.ID, true, nil
+}
+
+// writeAccountError maps AccountStore errors to HTTP status codes
+func writeAccountError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrAccountNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrAccountExists), errors.Is(err, ErrLastAdmin):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrBadCredentials):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{if .Setup}}Set up{{else}}Sign in{{end}} · AMSKU Task Management</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            min-height: 100vh;
+            margin: 0;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+        }
+        form {
+            background: white;
+            border-radius: 20px;
+            box-shadow: 0 20px 40px rgba(0,0,0,0.1);
+            padding: 30px;
+            width: 320px;
+        }
+        h1 {
+            font-size: 1.5rem;
+            color: #1e293b;
+            margin: 0 0 20px;
+        }
+        label {
+            display: block;
+            font-weight: 600;
+            color: #374151;
+            margin-bottom: 5px;
+        }
+        input {
+            width: 100%;
+            box-sizing: border-box;
+            padding: 8px 12px;
+            border: 2px solid #e5e7eb;
+            border-radius: 8px;
+            font-size: 14px;
+            margin-bottom: 15px;
+        }
+        button {
+            width: 100%;
+            padding: 10px 20px;
+            border: none;
+            border-radius: 8px;
+            font-weight: 600;
+            background: #4f46e5;
+            color: white;
+            cursor: pointer;
+        }
+        .error {
+            background: #fef2f2;
+            color: #dc2626;
+            border-radius: 8px;
+            padding: 10px;
+            margin-bottom: 15px;
+        }
+    </style>
+</head>
+<body>
+    <form method="POST">
+        <h1>{{if .Setup}}🎯 Create the first account{{else}}🎯 Sign in{{end}}</h1>
+        {{with .Error}}<div class="error">{{.}}</div>{{end}}
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+        {{if .Setup}}
+        <label for="name">Your name</label>
+        <input id="name" name="name" value="{{.Name}}" required>
+        {{end}}
+        <label for="username">Username</label>
+        <input id="username" name="username" value="{{.Username}}" autocomplete="username" required autofocus>
+        <label for="password">Password</label>
+        <input id="password" name="password" type="password" autocomplete="{{if .Setup}}new-password{{else}}current-password{{end}}" required>
+        <button type="submit">{{if .Setup}}Create account{{else}}Sign in{{end}}</button>
+    </form>
+</body>
+</html>`))
+
+type loginForm struct {
+	Setup     bool
+	Error     string
+	CSRFToken string
+	Name      string
+	Username  string
+}
+
+// renderLoginPage shows the sign-in or setup form with a fresh form CSRF token.
+func renderLoginPage(w http.ResponseWriter, r *http.Request, status int, form loginForm) {
+	token, err := randomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     formCSRFCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	form.CSRFToken = token
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	loginPage.Execute(w, form)
+}
+
+// checkFormCSRF compares the token in a submitted form with its cookie.
+func checkFormCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(formCSRFCookie)
+	return err == nil && tokensMatch(r.PostFormValue("csrf_token"), cookie.Value)
+}
+
+// loginHandler serves the sign-in page at /login
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if accounts.Empty() {
+		http.Redirect(w, r, "/setup", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if _, _, ok := currentSession(r); ok {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		renderLoginPage(w, r, http.StatusOK, loginForm{})
+
+	case "POST":
+		form := loginForm{Username: r.PostFormValue("username")}
+		if !checkFormCSRF(r) {
+			form.Error = "Your form expired, please try again."
+			renderLoginPage(w, r, http.StatusForbidden, form)
+			return
+		}
+		if _, _, err := signIn(w, r, form.Username, r.PostFormValue("password")); err != nil {
+			form.Error = "Invalid username or password."
+			renderLoginPage(w, r, http.StatusUnauthorized, form)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
+	}
+}
+
+// setupHandler serves /setup, which creates the first account on a new
+// installation and is closed once any account exists. Two people setting
+// up at once cannot both get in: CreateFirst checks for accounts under the
+// store's lock.
+func setupHandler(w http.ResponseWriter, r *http.Request) {
+	if !accounts.Empty() {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		renderLoginPage(w, r, http.StatusOK, loginForm{Setup: true})
+
+	case "POST":
+		form := loginForm{Setup: true, Name: r.PostFormValue("name"), Username: r.PostFormValue("username")}
+		if !checkFormCSRF(r) {
+			form.Error = "Your form expired, please try again."
+			renderLoginPage(w, r, http.StatusForbidden, form)
+			return
+		}
+		password := r.PostFormValue("password")
+		// Whoever sets up the installation administers it.
+		_, err := withAccountPerson("", form.Name, func(personID PersonID) (Account, error) {
+			return accounts.CreateFirst(form.Username, password, personID)
+		})
+		if errors.Is(err, ErrSetupDone) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			form.Error = err.Error()
+			renderLoginPage(w, r, http.StatusUnprocessableEntity, form)
+			return
+		}
+		if _, _, err := signIn(w, r, form.Username, password); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
+	}
+}
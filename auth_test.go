@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSessionCSRF(t *testing.T) {
+	srv := newTestServer(t)
+	addAccount(t, "colin", RoleAdmin)
+	session := signedIn(t, srv, "colin")
+	withCSRF := func(csrf string) *testClient {
+		c := *session
+		c.csrf = csrf
+		return &c
+	}
+	task := map[string]string{"title": "Fix the gate", "type": categories.Name(CategoryOngoing), "priority": "Medium"}
+
+	tests := []struct {
+		name         string
+		client       *testClient
+		method, path string
+		body         any
+		want         int
+	}{
+		{"no session", newTestClient(t, srv), "GET", "/api/tasks", nil, http.StatusUnauthorized},
+		{"reading needs no CSRF token", withCSRF(""), "GET", "/api/tasks", nil, http.StatusOK},
+		{"no CSRF token", withCSRF(""), "POST", "/api/tasks", task, http.StatusForbidden},
+		{"wrong CSRF token", withCSRF("not-the-token"), "POST", "/api/tasks", task, http.StatusForbidden},
+		{"right CSRF token", session, "POST", "/api/tasks", task, http.StatusOK},
+		{"signing out without a CSRF token", withCSRF(""), "DELETE", "/api/session", nil, http.StatusForbidden},
+		{"wrong password", newTestClient(t, srv), "POST", "/api/session", map[string]string{"username": "colin", "password": "wrong"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := tt.client.do(tt.method, tt.path, tt.body, nil); got != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	// A form posted from another site cannot sign in
+	resp, err := http.Post(srv.URL+"/api/session", "application/x-www-form-urlencoded", strings.NewReader("username=colin&password="+testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("signing in with a form = %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+
+	if got := session.do("DELETE", "/api/session", nil, nil); got != http.StatusNoContent {
+		t.Fatalf("signing out = %d, want %d", got, http.StatusNoContent)
+	}
+	if got := session.do("GET", "/api/session", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("session after signing out = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := session.do("POST", "/api/tasks", task, nil); got != http.StatusUnauthorized {
+		t.Errorf("writing after signing out = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+// postSetup submits the setup form, with a form CSRF token.
+func postSetup(t *testing.T, srv string, name, username, password string) int {
+	t.Helper()
+	form := url.Values{"csrf_token": {"form-token"}, "name": {name}, "username": {username}, "password": {password}}
+	req, err := http.NewRequest("POST", srv+"/setup", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: formCSRFCookie, Value: "form-token"})
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestFailedAccountLeavesNoPerson(t *testing.T) {
+	srv := newTestServer(t)
+	if got := postSetup(t, srv.URL, "Ana", "ana", "short"); got != http.StatusUnprocessableEntity {
+		t.Errorf("setup with a short password = %d, want %d", got, http.StatusUnprocessableEntity)
+	}
+	if n := len(people.List()); n != 0 {
+		t.Errorf("failed setup left %d people", n)
+	}
+	if got := postSetup(t, srv.URL, "Ana", "ana", testPassword); got != http.StatusSeeOther {
+		t.Fatalf("setup = %d, want %d", got, http.StatusSeeOther)
+	}
+
+	admin := signedIn(t, srv, "ana")
+	taken := map[string]string{"username": "ana", "password": testPassword, "name": "Bo"}
+	if got := admin.do("POST", "/api/accounts", taken, nil); got != http.StatusConflict {
+		t.Errorf("adding an account with a taken username = %d, want %d", got, http.StatusConflict)
+	}
+	if _, ok := people.Lookup("Bo"); ok {
+		t.Error("failed account left its person behind")
+	}
+}
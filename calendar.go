@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icsTimeFormat is the UTC date-time form used in iCalendar files.
+const icsTimeFormat = "20060102T150405Z"
+
+// icsPriority maps task priorities onto iCalendar's 1 (highest) to 9 scale.
+var icsPriority = map[string]int{"High": 1, "Medium": 5, "Low": 9}
+
+// icsWriter builds an iCalendar file, folding long lines as RFC 5545 asks.
+type icsWriter struct {
+	b strings.Builder
+}
+
+// line writes one content line such as "SUMMARY:text", folded into chunks of
+// at most 75 bytes without splitting a UTF-8 sequence.
+func (w *icsWriter) line(name, value string) {
+	s := name + ":" + value
+	// Continuation lines start with a space, which counts towards the limit
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	w.b.WriteString(s + "\r\n")
+}
+
+// text writes a TEXT property, escaping the characters iCalendar reserves.
+func (w *icsWriter) text(name, value string) {
+	value = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+	w.line(name, value)
+}
+
+// writeCalendar writes the tasks that have due dates as an iCalendar file.
+// Each task becomes a VTODO, or with events set an all-day VEVENT on its
+// due date, since many calendar apps ignore to-dos.
+func writeCalendar(views []TaskView, name string, events bool, now time.Time) string {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//AMSKU//Task Management//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", name)
+	for _, v := range views {
+		if v.DueAt == nil {
+			continue
+		}
+		component := "VTODO"
+		if events {
+			component = "VEVENT"
+		}
+		w.line("BEGIN", component)
+		w.line("UID", "task-"+strconv.Itoa(v.ID)+"@amsku-tasks")
+		w.line("DTSTAMP", now.UTC().Format(icsTimeFormat))
+		w.line("CREATED", v.CreatedAt.UTC().Format(icsTimeFormat))
+		w.line("SEQUENCE", strconv.Itoa(v.Version))
+		w.text("SUMMARY", v.Title)
+		description := "Owner: " + v.Owner
+		if v.Notes != "" {
+			description += "\n\n" + v.Notes
+		}
+		w.text("DESCRIPTION", description)
+		w.text("CATEGORIES", v.Type)
+		if p, ok := icsPriority[v.Priority]; ok {
+			w.line("PRIORITY", strconv.Itoa(p))
+		}
+		if events {
+			day := v.DueAt.In(time.Local)
+			w.line("DTSTART;VALUE=DATE", day.Format("20060102"))
+			w.line("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format("20060102"))
+			w.line("TRANSP", "TRANSPARENT")
+		} else {
+			w.line("DUE", v.DueAt.UTC().Format(icsTimeFormat))
+			if v.Completed {
+				w.line("STATUS", "COMPLETED")
+				if v.CompletedAt != nil {
+					w.line("COMPLETED", v.CompletedAt.UTC().Format(icsTimeFormat))
+				}
+			} else {
+				w.line("STATUS", "NEEDS-ACTION")
+			}
+		}
+		w.line("END", component)
+	}
+	w.line("END", "VCALENDAR")
+	return w.b.String()
+}
+
+// calendarFeed lets calendar apps, which cannot send headers, authenticate
+// with an API token in the URL: /api/calendar.ics?token=liz_... A read-only
+// token is best, since URLs end up in logs and app settings.
+func calendarFeed(next http.HandlerFunc) http.HandlerFunc {
+	login := requireLogin(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+			params := r.URL.Query()
+			params.Del("token")
+			r.URL.RawQuery = params.Encode()
+		}
+		login(w, r)
+	}
+}
+
+// calendarHandler serves GET /api/calendar.ics, the tasks with due dates
+// as an iCalendar feed. It takes the filters of GET /api/tasks, so
+// ?owner=me gives a personal calendar, plus ?events=true for VEVENTs.
+func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET", "HEAD")
+		return
+	}
+	params := r.URL.Query()
+	events, _ := strconv.ParseBool(params.Get("events"))
+	params.Del("events")
+	name := "AMSKU Tasks"
+	if resolveOwnerMe(r.Context(), params) {
+		name = fmt.Sprintf("AMSKU Tasks (%s)", actorFrom(r.Context()))
+	}
+	query, err := parseTaskQuery(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Sort = "due_at"
+
+	now := time.Now()
+	matched, _, _ := query.Apply(viewTasks(taskManager.List(), now))
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Write([]byte(writeCalendar(matched, name, events, now)))
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// calendlySignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256>"
+	// of "<unix time>.<body>", keyed with the webhook's signing key.
+	calendlySignatureHeader = "Calendly-Webhook-Signature"
+	// calendlyTolerance is how old a signed request may be, against replays.
+	calendlyTolerance = 5 * time.Minute
+	// maxCalendlyBody limits the size of a webhook request, in bytes.
+	maxCalendlyBody = 1 << 20
+	// calendlyActor is the name changes made by the integration appear under.
+	calendlyActor = "Calendly"
+)
+
+var (
+	// ErrCalendlyNotConfigured is returned when no signing key has been set.
+	ErrCalendlyNotConfigured = errors.New("the Calendly integration has no signing key")
+	// ErrBadSignature is returned when a webhook's signature does not match.
+	ErrBadSignature = errors.New("invalid or expired webhook signature")
+)
+
+// CalendlyRule gives bookings of one Calendly event type their own owner,
+// type or priority. Empty fields fall back to the CalendlyConfig defaults.
+type CalendlyRule struct {
+	EventType string `json:"event_type"` // event type name, ignoring case, or URI
+	Owner     string `json:"owner,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+}
+
+// Matches reports whether the rule applies to an event type.
+func (r CalendlyRule) Matches(name, uri string) bool {
+	return strings.EqualFold(r.EventType, name) || (uri != "" && r.EventType == uri)
+}
+
+// CalendlyConfig says how Calendly bookings become tasks. Bookings are
+// owned by the first matching rule's owner, else by the event's host if
+// they are in the People registry, else by Owner.
+type CalendlyConfig struct {
+	SigningKey string         `json:"signing_key,omitempty"` // never returned by the API
+	Owner      string         `json:"owner"`
+	Type       string         `json:"type"`
+	Priority   string         `json:"priority"`
+	Rules      []CalendlyRule `json:"rules"`
+}
+
+// calendlyWebhook is the part of a Calendly webhook request that is used.
+type calendlyWebhook struct {
+	Event   string          `json:"event"` // invitee.created or invitee.canceled
+	Payload calendlyInvitee `json:"payload"`
+}
+
+type calendlyInvitee struct {
+	URI           string `json:"uri"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Rescheduled   bool   `json:"rescheduled"`
+	OldInvitee    string `json:"old_invitee"`
+	CancelURL     string `json:"cancel_url"`
+	RescheduleURL string `json:"reschedule_url"`
+	Cancellation  *struct {
+		CanceledBy string `json:"canceled_by"`
+		Reason     string `json:"reason"`
+	} `json:"cancellation"`
+	Questions []struct {
+		Question string `json:"question"`
+		Answer   string `json:"answer"`
+	} `json:"questions_and_answers"`
+	ScheduledEvent struct {
+		URI         string    `json:"uri"`
+		Name        string    `json:"name"`
+		StartTime   time.Time `json:"start_time"`
+		EndTime     time.Time `json:"end_time"`
+		EventType   string    `json:"event_type"`
+		Memberships []struct {
+			UserName  string `json:"user_name"`
+			UserEmail string `json:"user_email"`
+		} `json:"event_memberships"`
+	} `json:"scheduled_event"`
+}
+
+// calendlyState is what the integration keeps in the store.
+type calendlyState struct {
+	Config CalendlyConfig `json:"config"`
+	// Tasks maps invitee URIs to the follow-up task made for them, so
+	// cancellations and reschedules find it.
+	Tasks map[string]int `json:"tasks"`
+}
+
+// CalendlyIntegration turns Calendly bookings and cancellations into tasks.
+type CalendlyIntegration struct {
+	// handling is held by Handle from looking up an invitee's task to
+	// linking the one it makes, so a webhook Calendly delivers twice at
+	// once makes one task. It is apart from mu, which a category rename
+	// takes while holding the task lock.
+	handling sync.Mutex
+	mu       sync.Mutex
+	store    Store
+	state    calendlyState
+}
+
+// calendly receives Calendly webhooks
+var calendly *CalendlyIntegration
+
+// NewCalendlyIntegration loads the integration's settings from store.
+func NewCalendlyIntegration(store Store) (*CalendlyIntegration, error) {
+	state := calendlyState{Config: CalendlyConfig{Priority: "Medium", Rules: []CalendlyRule{}}}
+	found, err := store.Load("calendly", &state)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		state.Config.Type = categories.Name(CategoryImmediate)
+	}
+	if state.Tasks == nil {
+		state.Tasks = map[string]int{}
+	}
+	return &CalendlyIntegration{store: store, state: state}, nil
+}
+
+// Config returns the settings without the signing key.
+func (c *CalendlyIntegration) Config() (config CalendlyConfig, keySet bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config = c.state.Config
+	keySet = config.SigningKey != ""
+	config.SigningKey = ""
+	return config, keySet
+}
+
+// SetConfig saves new settings, keeping the signing key if none is given.
+func (c *CalendlyIntegration) SetConfig(config CalendlyConfig) error {
+	if err := validateCalendlyConfig(config); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if config.SigningKey == "" {
+		config.SigningKey = c.state.Config.SigningKey
+	}
+	if config.Rules == nil {
+		config.Rules = []CalendlyRule{}
+	}
+	state := c.state
+	state.Config = config
+	if err := c.store.Save("calendly", state); err != nil {
+		return err
+	}
+	c.state = state
+	return nil
+}
+
+// RenameType follows a category rename in the default type and the rules.
+func (c *CalendlyIntegration) RenameType(from, to string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config := c.state.Config
+	config.Rules = slices.Clone(config.Rules)
+	changed := false
+	if config.Type == from {
+		config.Type = to
+		changed = true
+	}
+	for i := range config.Rules {
+		if config.Rules[i].Type == from {
+			config.Rules[i].Type = to
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	state := c.state
+	state.Config = config
+	if err := c.store.Save("calendly", state); err != nil {
+		return err
+	}
+	c.state = state
+	return nil
+}
+
+// link remembers the task made for an invitee.
+func (c *CalendlyIntegration) link(invitee string, taskID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tasks := make(map[string]int, len(c.state.Tasks)+1)
+	for k, v := range c.state.Tasks {
+		tasks[k] = v
+	}
+	tasks[invitee] = taskID
+	state := c.state
+	state.Tasks = tasks
+	if err := c.store.Save("calendly", state); err != nil {
+		return err
+	}
+	c.state = state
+	return nil
+}
+
+// remember links a task to an invitee after it was made. The task exists
+// either way, so a failure is only logged: were the webhook refused,
+// Calendly's retry would make the task again.
+func (c *CalendlyIntegration) remember(invitee string, taskID int) {
+	if err := c.link(invitee, taskID); err != nil {
+		log.Printf("calendly: linking task %d to %s: %v", taskID, invitee, err)
+	}
+}
+
+// linked returns the task made for an invitee, if it still exists.
+func (c *CalendlyIntegration) linked(invitee string) (Task, bool) {
+	c.mu.Lock()
+	id, ok := c.state.Tasks[invitee]
+	c.mu.Unlock()
+	if !ok || invitee == "" {
+		return Task{}, false
+	}
+	task, err := taskManager.Get(id)
+	return task, err == nil
+}
+
+// Verify checks a request's signature header against body.
+func (c *CalendlyIntegration) Verify(header string, body []byte, now time.Time) error {
+	c.mu.Lock()
+	key := c.state.Config.SigningKey
+	c.mu.Unlock()
+	if key == "" {
+		return ErrCalendlyNotConfigured
+	}
+
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > calendlyTolerance || age < -calendlyTolerance {
+		return ErrBadSignature
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// newTask makes the follow-up task for a booking, applying the owner and
+// type mapping.
+func (c *CalendlyIntegration) newTask(invitee calendlyInvitee, title string) Task {
+	config, _ := c.Config()
+	event := invitee.ScheduledEvent
+	task := Task{Owner: config.Owner, Type: config.Type, Priority: config.Priority}
+	everyone := people.List()
+	for _, m := range event.Memberships {
+		i := slices.IndexFunc(everyone, func(p Person) bool {
+			return strings.EqualFold(p.Name, m.UserName) || (p.Email != "" && strings.EqualFold(p.Email, m.UserEmail))
+		})
+		if i >= 0 {
+			task.Owner = everyone[i].Name
+			break
+		}
+	}
+	for _, rule := range config.Rules {
+		if !rule.Matches(event.Name, event.EventType) {
+			continue
+		}
+		task.Owner = valueOr(rule.Owner, task.Owner)
+		task.Type = valueOr(rule.Type, task.Type)
+		task.Priority = valueOr(rule.Priority, task.Priority)
+		break
+	}
+
+	task.Title = truncate(title, maxTitleLength)
+	task.Notes = truncate(describeBooking(invitee), maxNotesLength)
+	if !event.StartTime.IsZero() {
+		due := event.StartTime
+		task.DueAt = &due
+	}
+	return task
+}
+
+// describeBooking writes out a booking for a task's notes.
+func describeBooking(invitee calendlyInvitee) string {
+	event := invitee.ScheduledEvent
+	var b strings.Builder
+	fmt.Fprintf(&b, "Calendly booking: %s\n", event.Name)
+	if !event.StartTime.IsZero() {
+		start := event.StartTime.In(time.Local)
+		fmt.Fprintf(&b, "When: %s – %s\n", start.Format("Mon 2 Jan 2006 15:04"), event.EndTime.In(time.Local).Format("15:04"))
+	}
+	fmt.Fprintf(&b, "Invitee: %s <%s>\n", invitee.Name, invitee.Email)
+	for _, m := range event.Memberships {
+		fmt.Fprintf(&b, "Host: %s <%s>\n", m.UserName, m.UserEmail)
+	}
+	for _, qa := range invitee.Questions {
+		fmt.Fprintf(&b, "%s %s\n", qa.Question, qa.Answer)
+	}
+	if invitee.RescheduleURL != "" {
+		fmt.Fprintf(&b, "Reschedule: %s\n", invitee.RescheduleURL)
+	}
+	if invitee.CancelURL != "" {
+		fmt.Fprintf(&b, "Cancel: %s\n", invitee.CancelURL)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// Handle applies a webhook to the tasks. It returns the task it made or
+// changed and what it did: "created", "updated", "unchanged" or "ignored".
+func (c *CalendlyIntegration) Handle(ctx context.Context, hook calendlyWebhook) (Task, string, error) {
+	c.handling.Lock()
+	defer c.handling.Unlock()
+
+	invitee := hook.Payload
+	event := invitee.ScheduledEvent
+	switch hook.Event {
+	case "invitee.created":
+		if task, ok := c.linked(invitee.URI); ok {
+			return task, "unchanged", nil
+		}
+		// A reschedule cancels the old booking and creates this one; move
+		// the old booking's task rather than making another
+		if task, ok := c.linked(invitee.OldInvitee); ok {
+			if !event.StartTime.IsZero() {
+				due := event.StartTime
+				task.DueAt = &due
+			}
+			task.Notes = truncate(task.Notes+"\n\nRescheduled:\n"+describeBooking(invitee), maxNotesLength)
+			task, err := taskManager.Update(ctx, task.ID, task, task.Version)
+			if err != nil {
+				return Task{}, "", err
+			}
+			c.remember(invitee.URI, task.ID)
+			return task, "updated", nil
+		}
+		task, err := taskManager.Create(ctx, c.newTask(invitee, fmt.Sprintf("Follow up: %s with %s", event.Name, invitee.Name)))
+		if err != nil {
+			return Task{}, "", err
+		}
+		c.remember(invitee.URI, task.ID)
+		return task, "created", nil
+
+	case "invitee.canceled":
+		if invitee.Rescheduled {
+			// The invitee.created for the new time updates the task
+			return Task{}, "ignored", nil
+		}
+		note := "Canceled"
+		if invitee.Cancellation != nil {
+			note = fmt.Sprintf("Canceled by %s", invitee.Cancellation.CanceledBy)
+			if invitee.Cancellation.Reason != "" {
+				note += ": " + invitee.Cancellation.Reason
+			}
+		}
+		if task, ok := c.linked(invitee.URI); ok {
+			if strings.HasPrefix(task.Title, "Canceled: ") {
+				return task, "unchanged", nil
+			}
+			task.Title = truncate("Canceled: "+task.Title, maxTitleLength)
+			task.Notes = truncate(task.Notes+"\n\n"+note, maxNotesLength)
+			task, err := taskManager.Update(ctx, task.ID, task, task.Version)
+			if err != nil {
+				return Task{}, "", err
+			}
+			return task, "updated", nil
+		}
+		task := c.newTask(invitee, fmt.Sprintf("Canceled: %s with %s", event.Name, invitee.Name))
+		task.Notes = truncate(note+"\n\n"+task.Notes, maxNotesLength)
+		task, err := taskManager.Create(ctx, task)
+		if err != nil {
+			return Task{}, "", err
+		}
+		c.remember(invitee.URI, task.ID)
+		return task, "created", nil
+	}
+	return Task{}, "ignored", nil
+}
+
+// calendlyHandler serves POST /api/integrations/calendly, the receiver for
+// Calendly webhook subscriptions. Calendly cannot sign in, so requests are
+// checked against the signing key instead.
+func calendlyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCalendlyBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	if err := calendly.Verify(r.Header.Get(calendlySignatureHeader), body, time.Now()); err != nil {
+		if errors.Is(err, ErrCalendlyNotConfigured) {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		} else {
+			writeError(w, http.StatusUnauthorized, err.Error())
+		}
+		return
+	}
+	var hook calendlyWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	task, action, err := calendly.Handle(withActor(r.Context(), calendlyActor), hook)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	result := map[string]any{"action": action}
+	if task.ID != 0 {
+		result["task"] = viewTask(task, time.Now())
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// calendlyConfigHandler serves /api/integrations/calendly/config, the
+// integration's settings. The signing key can be set but not read back.
+func calendlyConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requirePermission(w, r, PermManageIntegrations) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var config CalendlyConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		config.SigningKey = strings.TrimSpace(config.SigningKey)
+		if err := calendly.SetConfig(config); err != nil {
+			var invalid *ValidationError
+			if errors.As(err, &invalid) {
+				writeValidationError(w, invalid)
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+	default:
+		methodNotAllowed(w, r, "GET", "PUT")
+		return
+	}
+	config, keySet := calendly.Config()
+	json.NewEncoder(w).Encode(struct {
+		CalendlyConfig
+		SigningKeySet bool `json:"signing_key_set"`
+	}{config, keySet})
+}
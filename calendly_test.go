@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "calendly-key"
+
+// signCalendly signs body as Calendly would at the given time.
+func signCalendly(key string, body []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// bookingWebhook returns the body of an invitee.created webhook.
+func bookingWebhook(t *testing.T, invitee string) []byte {
+	t.Helper()
+	var hook calendlyWebhook
+	hook.Event = "invitee.created"
+	hook.Payload.URI = invitee
+	hook.Payload.Name = "Bo Ruiz"
+	hook.Payload.ScheduledEvent.Name = "Viewing"
+	body, err := json.Marshal(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// postCalendly sends a webhook to srv with the given signature header.
+func postCalendly(t *testing.T, srv *httptest.Server, body []byte, signature string) int {
+	t.Helper()
+	req, err := http.NewRequest("POST", srv.URL+"/api/integrations/calendly", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != "" {
+		req.Header.Set(calendlySignatureHeader, signature)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// configureCalendly sets the signing key, with bookings going to Ana.
+func configureCalendly(t *testing.T) {
+	t.Helper()
+	addPerson(t, "Ana", "")
+	config, _ := calendly.Config()
+	config.Owner, config.SigningKey = "Ana", testSigningKey
+	if err := calendly.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalendlySignature(t *testing.T) {
+	srv := newTestServer(t)
+	body := bookingWebhook(t, "https://api.calendly.com/invitees/1")
+	if got := postCalendly(t, srv, body, signCalendly(testSigningKey, body, time.Now())); got != http.StatusServiceUnavailable {
+		t.Errorf("webhook before a signing key is set = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	configureCalendly(t)
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		signature string
+		want      int
+	}{
+		{"no signature", "", http.StatusUnauthorized},
+		{"malformed", "v1=abc", http.StatusUnauthorized},
+		{"not hex", fmt.Sprintf("t=%d,v1=zz", now.Unix()), http.StatusUnauthorized},
+		{"wrong key", signCalendly("other-key", body, now), http.StatusUnauthorized},
+		{"other body", signCalendly(testSigningKey, []byte(`{}`), now), http.StatusUnauthorized},
+		{"too old", signCalendly(testSigningKey, body, now.Add(-calendlyTolerance-time.Minute)), http.StatusUnauthorized},
+		{"too far ahead", signCalendly(testSigningKey, body, now.Add(calendlyTolerance+time.Minute)), http.StatusUnauthorized},
+		{"within tolerance", signCalendly(testSigningKey, body, now.Add(-calendlyTolerance+time.Minute)), http.StatusOK},
+		{"current", signCalendly(testSigningKey, body, now), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := postCalendly(t, srv, body, tt.signature); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if n := len(taskManager.List()); n != 1 {
+		t.Errorf("accepted webhooks made %d tasks, want 1", n)
+	}
+}
+
+func TestCalendlyDuplicateDelivery(t *testing.T) {
+	newTestStore(t)
+	configureCalendly(t)
+	var hook calendlyWebhook
+	if err := json.Unmarshal(bookingWebhook(t, "https://api.calendly.com/invitees/1"), &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := calendly.Handle(context.Background(), hook); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(taskManager.List()); n != 1 {
+		t.Errorf("one booking delivered 10 times at once made %d tasks, want 1", n)
+	}
+}
+
+func TestCalendlyLinkFailure(t *testing.T) {
+	store := newTestStore(t)
+	srv := httptest.NewServer(routes())
+	t.Cleanup(srv.Close)
+	configureCalendly(t)
+	// The booking's task is made, but it cannot be linked to the invitee
+	state := calendly.state
+	var err error
+	if calendly, err = NewCalendlyIntegration(failingStore{store, "calendly"}); err != nil {
+		t.Fatal(err)
+	}
+	calendly.state = state
+
+	body := bookingWebhook(t, "https://api.calendly.com/invitees/1")
+	if got := postCalendly(t, srv, body, signCalendly(testSigningKey, body, time.Now())); got != http.StatusOK {
+		t.Errorf("webhook whose task was made = %d, want %d so Calendly does not retry it", got, http.StatusOK)
+	}
+	if n := len(taskManager.List()); n != 1 {
+		t.Errorf("made %d tasks, want 1", n)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUpdateCategoryRenamesEverywhere(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+	addPerson(t, "Ana", "")
+	old := categories.Name(CategoryOngoing)
+	createTask(t, ctx, Task{Title: "Water the plants"})
+	config := CalendlyConfig{Owner: "Ana", Type: old, Priority: "Medium", Rules: []CalendlyRule{{EventType: "Viewing", Type: old}}}
+	if err := calendly.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := transcriptManager.Ingest("Standup", "Ana: I will water the plants every week.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Drafts) != 1 || tr.Drafts[0].Task.Type != old {
+		t.Fatalf("drafts = %+v, want one of type %q", tr.Drafts, old)
+	}
+
+	// Tasks created while the category is renamed either make it in
+	// before the rename and move with it, or are refused
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taskManager.Create(ctx, Task{Title: fmt.Sprintf("Task %d", i), Type: old, Priority: "Medium"})
+		}()
+	}
+	renamed := categories.Name(CategoryOngoing) + " (renamed)"
+	c, _ := categories.Get(CategoryOngoing)
+	c.Name = renamed
+	if _, _, err := taskManager.UpdateCategory(ctx, CategoryOngoing, c); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err := transcriptManager.RenameType(old, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range taskManager.List() {
+		if task.Type != renamed {
+			t.Errorf("task %d %q kept type %q", task.ID, task.Title, task.Type)
+		}
+	}
+	if config, _ := calendly.Config(); config.Type != renamed || config.Rules[0].Type != renamed {
+		t.Errorf("Calendly mapping = %q and %q, want %q", config.Type, config.Rules[0].Type, renamed)
+	}
+	tr, _ = transcriptManager.Get(tr.ID)
+	for _, d := range tr.Drafts {
+		if d.Task.Type != renamed {
+			t.Errorf("draft %d kept type %q", d.ID, d.Task.Type)
+		}
+	}
+}
+
+func TestUpdateCategoryUndoesFailedRename(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	var err error
+	if calendly, err = NewCalendlyIntegration(failingStore{store, "calendly"}); err != nil {
+		t.Fatal(err)
+	}
+	old := categories.Name(CategoryOngoing)
+	calendly.state.Config.Type = old
+	task := createTask(t, ctx, Task{Title: "Water the plants"})
+
+	c, _ := categories.Get(CategoryOngoing)
+	c.Name = "Everyday"
+	if _, _, err := taskManager.UpdateCategory(ctx, CategoryOngoing, c); err == nil {
+		t.Fatal("rename succeeded though the Calendly mapping could not be saved")
+	}
+	if c, _ := categories.Get(CategoryOngoing); c.Name != old {
+		t.Errorf("category name = %q, want %q restored", c.Name, old)
+	}
+	if task, _ := taskManager.Get(task.ID); task.Type != old {
+		t.Errorf("task type = %q, want %q restored", task.Type, old)
+	}
+}
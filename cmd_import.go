@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runImportCommand implements the "import" subcommand. It sends a CSV or
+// iCalendar file to a running server, shows the preview and, once
+// confirmed, imports the new tasks.
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8000", "base URL of the task server")
+	user := fs.String("user", os.Getenv("LIZ_USER"), "username to sign in as; the password is read from LIZ_PASSWORD (not needed with LIZ_TOKEN)")
+	format := fs.String("format", "", "csv or ics (guessed from the file name or content if empty)")
+	mapping := fs.String("map", "", "CSV column for each task field, e.g. \"title=Action Item,owner=Assigned To\"")
+	taskType := fs.String("type", "", "type for rows without one")
+	owner := fs.String("owner", "", "owner for rows without one")
+	priority := fs.String("priority", "Medium", "priority for rows without one")
+	acceptAll := fs.Bool("yes", false, "import without asking")
+	dryRun := fs.Bool("dry-run", false, "only show what would be imported")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: liz-assistant import [flags] <file.csv|file.ics|->")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("import file required")
+	}
+
+	req := ImportRequest{Format: *format, Mapping: map[string]string{}}
+	req.Defaults.Type, req.Defaults.Owner, req.Defaults.Priority = *taskType, *owner, *priority
+	for _, pair := range strings.Split(*mapping, ",") {
+		if pair == "" {
+			continue
+		}
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("-map entry %q is not field=column", pair)
+		}
+		req.Mapping[strings.TrimSpace(field)] = strings.TrimSpace(column)
+	}
+
+	path := fs.Arg(0)
+	var (
+		content []byte
+		err     error
+	)
+	if path == "-" {
+		if !*acceptAll && !*dryRun {
+			return errors.New("reading the file from stdin needs -yes or -dry-run")
+		}
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+		if req.Format == "" {
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ics", ".ical":
+				req.Format = ImportICS
+			case ".csv":
+				req.Format = ImportCSV
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Content = string(content)
+
+	client, err := connect(*server, *user)
+	if err != nil {
+		return err
+	}
+
+	req.DryRun = true
+	var preview ImportResult
+	if err := client.postImport(req, &preview); err != nil {
+		return err
+	}
+	printImport(preview)
+	if preview.Invalid > 0 {
+		return fmt.Errorf("%d rows are invalid; fix them or pass defaults with -type, -owner and -priority", preview.Invalid)
+	}
+	if preview.New == 0 || *dryRun {
+		return nil
+	}
+	if !*acceptAll {
+		fmt.Printf("\nImport %d tasks? [y/N] ", preview.New)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing imported.")
+			return nil
+		}
+	}
+
+	req.DryRun = false
+	var result ImportResult
+	if err := client.postImport(req, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d tasks.\n", len(result.Created))
+	return nil
+}
+
+func (c *apiClient) postImport(req ImportRequest, out *ImportResult) error {
+	body, _ := json.Marshal(req)
+	return c.do("POST", "/api/import", "application/json", body, out)
+}
+
+func printImport(r ImportResult) {
+	if len(r.Columns) > 0 {
+		fields := make([]string, 0, len(r.Mapping))
+		for field, column := range r.Mapping {
+			fields = append(fields, field+"="+column)
+		}
+		sort.Strings(fields)
+		fmt.Printf("Columns: %s\nMapping: %s\n", strings.Join(r.Columns, ", "), strings.Join(fields, ", "))
+	}
+	for _, row := range r.Rows {
+		status := "new"
+		switch {
+		case row.DuplicateOf != 0:
+			status = fmt.Sprintf("skip: same title as task %d", row.DuplicateOf)
+		case row.DuplicateRow != 0:
+			status = fmt.Sprintf("skip: same title as row %d", row.DuplicateRow)
+		case len(row.Errors) > 0:
+			var problems []string
+			for _, e := range row.Errors {
+				problems = append(problems, e.Field+" "+e.Message)
+			}
+			status = "invalid: " + strings.Join(problems, "; ")
+		}
+		due := "-"
+		if row.Task.DueAt != nil {
+			due = row.Task.DueAt.Format("2006-01-02")
+		}
+		fmt.Printf("%4d  %-50.50s  %-15.15s  %s  %s\n", row.Row, valueOr(row.Task.Title, "?"), valueOr(row.Task.Owner, "?"), due, status)
+	}
+	fmt.Printf("\n%d new, %d duplicates, %d invalid\n", r.New, r.Duplicates, r.Invalid)
+}
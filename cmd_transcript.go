@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runTranscriptCommand implements the "transcript" subcommand. It sends a
+// transcript to a running server, shows the proposed tasks and asks which
+// ones to accept.
+func runTranscriptCommand(args []string) error {
+	fs := flag.NewFlagSet("transcript", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8000", "base URL of the task server")
+	user := fs.String("user", os.Getenv("LIZ_USER"), "username to sign in as; the password is read from LIZ_PASSWORD (not needed with LIZ_TOKEN)")
+	name := fs.String("name", "", "name for the transcript (defaults to the file name)")
+	acceptAll := fs.Bool("yes", false, "accept every proposed task without asking")
+	listOnly := fs.Bool("list", false, "only list proposed tasks, leaving them pending review")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: liz-assistant transcript [flags] <file.txt|file.vtt|->")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("transcript file required")
+	}
+
+	path := fs.Arg(0)
+	var (
+		text []byte
+		err  error
+	)
+	if path == "-" {
+		if !*acceptAll && !*listOnly {
+			return errors.New("reading the transcript from stdin needs -yes or -list")
+		}
+		text, err = io.ReadAll(os.Stdin)
+	} else {
+		text, err = os.ReadFile(path)
+		if *name == "" {
+			*name = filepath.Base(path)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := connect(*server, *user)
+	if err != nil {
+		return err
+	}
+	var t Transcript
+	if err := client.do("POST", "/api/transcripts?name="+url.QueryEscape(*name), "text/plain", text, &t); err != nil {
+		return err
+	}
+
+	fmt.Printf("Transcript %d %q: %d proposed tasks\n", t.ID, t.Name, len(t.Drafts))
+	if len(t.Drafts) == 0 || *listOnly {
+		for _, d := range t.Drafts {
+			printDraft(d)
+		}
+		return nil
+	}
+
+	var accepted, rejected []DraftDecision
+	in := bufio.NewReader(os.Stdin)
+	for _, d := range t.Drafts {
+		printDraft(d)
+		if *acceptAll {
+			accepted = append(accepted, DraftDecision{ID: d.ID})
+			continue
+		}
+		fmt.Print("  Accept? [y/N/q] ")
+		answer, _ := in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			accepted = append(accepted, DraftDecision{ID: d.ID})
+		case "q", "quit":
+			fmt.Println("Remaining drafts left pending review.")
+			return client.review(t.ID, accepted, rejected)
+		default:
+			rejected = append(rejected, DraftDecision{ID: d.ID})
+		}
+	}
+	return client.review(t.ID, accepted, rejected)
+}
+
+func printDraft(d DraftTask) {
+	fmt.Printf("\n#%d %s\n", d.ID, d.Task.Title)
+	fmt.Printf("  owner: %s  priority: %s  type: %s\n", valueOr(d.Task.Owner, "?"), d.Task.Priority, d.Task.Type)
+	fmt.Printf("  from:  %s\n", d.Source)
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// apiClient is a minimal JSON client for the task server's API.
+type apiClient struct {
+	base   string
+	client *http.Client
+	csrf   string
+	token  string // API token, used instead of signing in
+}
+
+func newAPIClient(base string) (*apiClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &apiClient{base: base, client: &http.Client{Jar: jar}}, nil
+}
+
+// connect returns a client for server that uses LIZ_TOKEN if it is set,
+// and otherwise signs in as user with LIZ_PASSWORD.
+func connect(server, user string) (*apiClient, error) {
+	client, err := newAPIClient(strings.TrimRight(server, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("LIZ_TOKEN"); token != "" {
+		client.token = token
+	} else if err := client.login(user, os.Getenv("LIZ_PASSWORD")); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// login signs in, keeping the session cookie and CSRF token for later calls.
+func (c *apiClient) login(username, password string) error {
+	if username == "" || password == "" {
+		return errors.New("set LIZ_TOKEN, or sign in with -user (or LIZ_USER) and LIZ_PASSWORD")
+	}
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	var session sessionView
+	if err := c.do("POST", "/api/session", "application/json", body, &session); err != nil {
+		return err
+	}
+	c.csrf = session.CSRFToken
+	return nil
+}
+
+func (c *apiClient) do(method, path, contentType string, body []byte, out any) error {
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.csrf != "" {
+		req.Header.Set(csrfHeader, c.csrf)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// review sends the accepted and rejected drafts back to the server.
+func (c *apiClient) review(transcriptID int, accepted, rejected []DraftDecision) error {
+	base := "/api/transcripts/" + strconv.Itoa(transcriptID)
+	if len(accepted) > 0 {
+		body, _ := json.Marshal(map[string]any{"drafts": accepted})
+		var result struct {
+			Tasks []Task `json:"tasks"`
+		}
+		if err := c.do("POST", base+"/accept", "application/json", body, &result); err != nil {
+			return err
+		}
+		for _, task := range result.Tasks {
+			fmt.Printf("Created task %d: %s\n", task.ID, task.Title)
+		}
+	}
+	if len(rejected) > 0 {
+		body, _ := json.Marshal(map[string]any{"drafts": rejected})
+		if err := c.do("POST", base+"/reject", "application/json", body, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Rejected %d proposed tasks.\n", len(rejected))
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCommentLength limits the size of a comment, in characters.
+const maxCommentLength = 5000
+
+var (
+	// ErrCommentNotFound is returned when a task has no comment with the requested ID.
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrNotCommentAuthor is returned when someone edits or deletes another person's comment.
+	ErrNotCommentAuthor = errors.New("only the author can change a comment")
+)
+
+// Comment is one message in the discussion thread of a task.
+type Comment struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	Author    string     `json:"author"`    // name at the time, for display
+	AuthorID  string     `json:"author_id"` // username of the author's account
+	Body      string     `json:"body"`
+	Mentions  []PersonID `json:"mentions"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+}
+
+// authorID returns the username of the account in ctx, or "" if there is
+// none.
+func authorID(ctx context.Context) string {
+	account, ok := accountFrom(ctx)
+	if !ok {
+		return ""
+	}
+	return account.Username
+}
+
+// writtenBy reports whether the account in ctx wrote the comment. Names
+// are not compared: they change on rename and need not be unique.
+func (c Comment) writtenBy(ctx context.Context) bool {
+	id := authorID(ctx)
+	return id != "" && c.AuthorID == id
+}
+
+// CommentStore holds the comment threads of all tasks.
+type CommentStore struct {
+	mu       sync.RWMutex
+	store    Store
+	comments []Comment
+	nextID   int
+	// deleted holds the tasks whose threads were removed, so a comment on
+	// a task found before its deletion is refused after it. Task IDs are
+	// never reused.
+	deleted map[int]bool
+}
+
+type commentSnapshot struct {
+	Comments []Comment `json:"comments"`
+	NextID   int       `json:"next_id"`
+}
+
+// comments holds the discussion threads on tasks
+var comments *CommentStore
+
+// NewCommentStore loads comments from store.
+func NewCommentStore(store Store) (*CommentStore, error) {
+	snap := commentSnapshot{Comments: []Comment{}, NextID: 1}
+	if _, err := store.Load("comments", &snap); err != nil {
+		return nil, err
+	}
+	return &CommentStore{store: store, comments: snap.Comments, nextID: snap.NextID, deleted: map[int]bool{}}, nil
+}
+
+// commit stores every task's comments and the next comment ID; if the save
+// fails the comments in memory are left alone. Callers must hold c.mu for
+// writing.
+func (c *CommentStore) commit(list []Comment, nextID int) error {
+	if err := c.store.Save("comments", commentSnapshot{Comments: list, NextID: nextID}); err != nil {
+		return err
+	}
+	c.comments, c.nextID = list, nextID
+	return nil
+}
+
+// index returns the position of a comment on a task, or -1.
+// Callers must hold c.mu.
+func (c *CommentStore) index(taskID, id int) int {
+	for i, comment := range c.comments {
+		if comment.ID == id && comment.TaskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// AssignAuthors gives comments written before authors were recorded by
+// account to the one account whose person has the comment's author name.
+// Names shared by several accounts are left unassigned.
+func (c *CommentStore) AssignAuthors(list []Account) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byName := map[string][]string{}
+	for _, account := range list {
+		name := actorFrom(withAccount(context.Background(), account))
+		byName[name] = append(byName[name], account.Username)
+	}
+	updated := append([]Comment{}, c.comments...)
+	changed := false
+	for i, comment := range updated {
+		if usernames := byName[comment.Author]; comment.AuthorID == "" && len(usernames) == 1 {
+			updated[i].AuthorID = usernames[0]
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return c.commit(updated, c.nextID)
+}
+
+// List returns the comments on a task, oldest first.
+func (c *CommentStore) List(taskID int) []Comment {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := []Comment{}
+	for _, comment := range c.comments {
+		if comment.TaskID == taskID {
+			list = append(list, comment)
+		}
+	}
+	return list
+}
+
+// Count returns how many comments a task has.
+func (c *CommentStore) Count(taskID int) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n := 0
+	for _, comment := range c.comments {
+		if comment.TaskID == taskID {
+			n++
+		}
+	}
+	return n
+}
+
+// Create adds a comment to a task on behalf of the actor in ctx. Once the
+// task is deleted it fails with ErrTaskNotFound.
+func (c *CommentStore) Create(ctx context.Context, taskID int, body string) (Comment, error) {
+	if err := validateComment(body); err != nil {
+		return Comment{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.deleted[taskID] {
+		return Comment{}, ErrTaskNotFound
+	}
+	comment := Comment{
+		ID:        c.nextID,
+		TaskID:    taskID,
+		Author:    actorFrom(ctx),
+		AuthorID:  authorID(ctx),
+		Body:      strings.TrimSpace(body),
+		CreatedAt: time.Now(),
+	}
+	comment.Mentions = findMentions(comment.Body)
+	if err := c.commit(append(append([]Comment{}, c.comments...), comment), c.nextID+1); err != nil {
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+// Update replaces the body of a comment. Only its author may edit it.
+func (c *CommentStore) Update(ctx context.Context, taskID, id int, body string) (Comment, error) {
+	if err := validateComment(body); err != nil {
+		return Comment{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := c.index(taskID, id)
+	if i < 0 {
+		return Comment{}, ErrCommentNotFound
+	}
+	comment := c.comments[i]
+	if !comment.writtenBy(ctx) {
+		return Comment{}, ErrNotCommentAuthor
+	}
+	now := time.Now()
+	comment.Body = strings.TrimSpace(body)
+	comment.Mentions = findMentions(comment.Body)
+	comment.EditedAt = &now
+
+	list := append([]Comment{}, c.comments...)
+	list[i] = comment
+	if err := c.commit(list, c.nextID); err != nil {
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+// Delete removes a comment. Only its author may delete it.
+func (c *CommentStore) Delete(ctx context.Context, taskID, id int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := c.index(taskID, id)
+	if i < 0 {
+		return ErrCommentNotFound
+	}
+	if !c.comments[i].writtenBy(ctx) {
+		return ErrNotCommentAuthor
+	}
+	list := append(append([]Comment{}, c.comments[:i]...), c.comments[i+1:]...)
+	return c.commit(list, c.nextID)
+}
+
+// deleteForTask removes the whole thread of a deleted task.
+func (c *CommentStore) deleteForTask(taskID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deleted[taskID] = true
+	list := []Comment{}
+	for _, comment := range c.comments {
+		if comment.TaskID != taskID {
+			list = append(list, comment)
+		}
+	}
+	if len(list) == len(c.comments) {
+		return nil
+	}
+	return c.commit(list, c.nextID)
+}
+
+// removeDeletedThreads is the TaskManager listener that drops the comments
+// of deleted tasks.
+func removeDeletedThreads(event TaskEvent) {
+	if event.Action != ActionDeleted {
+		return
+	}
+	if err := comments.deleteForTask(event.TaskID); err != nil {
+		log.Printf("comments: removing thread of task %d: %v", event.TaskID, err)
+	}
+}
+
+// findMentions returns the people @mentioned in a comment, by ID or name.
+// Longer names are tried first so "@Technical Team" is not read as "@Technical".
+func findMentions(body string) []PersonID {
+	list := people.List()
+	sort.Slice(list, func(i, j int) bool { return len(list[i].Name) > len(list[j].Name) })
+
+	mentions := []PersonID{}
+	for _, p := range list {
+		for _, handle := range []string{p.Name, string(p.ID)} {
+			re := regexp.MustCompile(`(?i)(^|[^\w@])@` + regexp.QuoteMeta(handle) + `\b`)
+			if re.MatchString(body) {
+				mentions = append(mentions, p.ID)
+				body = re.ReplaceAllString(body, "$1")
+				break
+			}
+		}
+	}
+	return mentions
+}
+
+func validateComment(body string) *ValidationError {
+	switch body = strings.TrimSpace(body); {
+	case body == "":
+		return &ValidationError{Fields: []FieldError{{Field: "body", Message: "is required"}}}
+	case utf8.RuneCountInString(body) > maxCommentLength:
+		return &ValidationError{Fields: []FieldError{{Field: "body", Message: fmt.Sprintf("must be at most %d characters", maxCommentLength)}}}
+	}
+	return nil
+}
+
+// commentsHandler serves /api/tasks/{id}/comments and /api/tasks/{id}/comments/{commentID}
+func commentsHandler(w http.ResponseWriter, r *http.Request, taskID int, rest string) {
+	if _, err := taskManager.Get(taskID); err != nil {
+		writeTaskError(w, err)
+		return
+	}
+
+	var body struct {
+		Body string `json:"body"`
+	}
+
+	if rest == "" {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(comments.List(taskID))
+
+		case "POST":
+			if !requirePermission(w, r, PermComment) {
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			comment, err := comments.Create(r.Context(), taskID, body.Body)
+			if err != nil {
+				writeCommentError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(comment)
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	commentID, err := strconv.Atoi(rest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+	if !safeMethod(r.Method) && !requirePermission(w, r, PermComment) {
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		comment, err := comments.Update(r.Context(), taskID, commentID, body.Body)
+		if err != nil {
+			writeCommentError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(comment)
+
+	case "DELETE":
+		if err := comments.Delete(r.Context(), taskID, commentID); err != nil {
+			writeCommentError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, r, "PUT", "DELETE")
+	}
+}
+
+// writeCommentError maps CommentStore errors to HTTP status codes
+func writeCommentError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrCommentNotFound), errors.Is(err, ErrTaskNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotCommentAuthor):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCommentAfterTaskDeleted(t *testing.T) {
+	newTestStore(t)
+	taskManager.Subscribe(removeDeletedThreads)
+	ctx := context.Background()
+	task := createTask(t, ctx, Task{Title: "Fix the gate"})
+	if _, err := comments.Create(ctx, task.ID, "Hinges ordered"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A comment whose task was looked up before the deletion arrives after it
+	if err := taskManager.Delete(ctx, task.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comments.Create(ctx, task.ID, "Fitted"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("comment on a deleted task: error = %v, want %v", err, ErrTaskNotFound)
+	}
+	if n := comments.Count(task.ID); n != 0 {
+		t.Errorf("deleted task has %d comments, want 0", n)
+	}
+}
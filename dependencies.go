@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrBlocked is returned when completing a task whose blockers are still open.
+var ErrBlocked = errors.New("task is blocked")
+
+// BlockedError lists the open tasks that stop a task from being completed.
+type BlockedError struct {
+	Blockers []Task
+}
+
+func (e *BlockedError) Error() string {
+	names := make([]string, len(e.Blockers))
+	for i, t := range e.Blockers {
+		names[i] = fmt.Sprintf("#%d %s", t.ID, t.Title)
+	}
+	return "task is blocked by " + strings.Join(names, ", ")
+}
+
+func (e *BlockedError) Unwrap() error { return ErrBlocked }
+
+type forceCompleteKey struct{}
+
+// withForceComplete returns a context in which tasks may be completed even
+// though tasks blocking them are still open.
+func withForceComplete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceCompleteKey{}, true)
+}
+
+// forceComplete reports whether ctx allows completing blocked tasks.
+func forceComplete(ctx context.Context) bool {
+	force, _ := ctx.Value(forceCompleteKey{}).(bool)
+	return force
+}
+
+// openBlockers returns the tasks in tasks that block task and are not done.
+func openBlockers(tasks []Task, task Task) []Task {
+	var open []Task
+	for _, t := range tasks {
+		if !t.Completed && slices.Contains(task.BlockedBy, t.ID) {
+			open = append(open, t)
+		}
+	}
+	return open
+}
+
+// blocking returns the IDs of the tasks that id blocks.
+func blocking(tasks []Task, id int) []int {
+	var ids []int
+	for _, t := range tasks {
+		if slices.Contains(t.BlockedBy, id) {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// Blockers returns the open tasks that block a task and the IDs of the
+// tasks it blocks.
+func (m *TaskManager) Blockers(task Task) (open []Task, blocks []int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return openBlockers(m.tasks, task), blocking(m.tasks, task.ID)
+}
+
+// checkBlockers sorts a task's blockers and makes sure each one is in tasks
+// and that following blockers from it never comes back to the task. tasks
+// includes any other tasks being created with it, so they can block each
+// other.
+func checkBlockers(tasks []Task, task *Task) error {
+	if len(task.BlockedBy) == 0 {
+		task.BlockedBy = nil
+		return nil
+	}
+	task.BlockedBy = slices.Clone(task.BlockedBy)
+	slices.Sort(task.BlockedBy)
+	task.BlockedBy = slices.Compact(task.BlockedBy)
+
+	invalid := func(message string) error {
+		return &ValidationError{Fields: []FieldError{{Field: "blocked_by", Message: message}}}
+	}
+	index := func(id int) int { return slices.IndexFunc(tasks, func(t Task) bool { return t.ID == id }) }
+	for _, id := range task.BlockedBy {
+		if id == task.ID {
+			return invalid("a task cannot block itself")
+		}
+		if index(id) < 0 {
+			return invalid("no task with ID " + strconv.Itoa(id))
+		}
+	}
+
+	// Walk everything the task waits on, directly or not. Reaching the task
+	// again means the new links close a loop.
+	seen := map[int]bool{}
+	queue := slices.Clone(task.BlockedBy)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == task.ID {
+			return invalid("would make the task wait on itself")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if i := index(id); i >= 0 {
+			queue = append(queue, tasks[i].BlockedBy...)
+		}
+	}
+	return nil
+}
+
+// checkCompletable returns a *BlockedError if task is being completed while
+// tasks in tasks blocking it are open, unless ctx forces completion.
+func checkCompletable(ctx context.Context, tasks []Task, before, task Task) error {
+	if !task.Completed || before.Completed || forceComplete(ctx) {
+		return nil
+	}
+	if open := openBlockers(tasks, task); len(open) > 0 {
+		return &BlockedError{Blockers: open}
+	}
+	return nil
+}
+
+// unlinkBlocker removes id from the blockers of every task, returning the
+// before and after of each task it changed.
+func unlinkBlocker(tasks []Task, id int) (changed [][2]Task) {
+	for i, t := range tasks {
+		if !slices.Contains(t.BlockedBy, id) {
+			continue
+		}
+		before := t
+		t.BlockedBy = slices.DeleteFunc(slices.Clone(t.BlockedBy), func(b int) bool { return b == id })
+		if len(t.BlockedBy) == 0 {
+			t.BlockedBy = nil
+		}
+		t.Version++
+		tasks[i] = t
+		changed = append(changed, [2]Task{before, t})
+	}
+	return changed
+}
+
+// completionContext returns the request's context, forcing completion of
+// blocked tasks if the request asks for it with ?force=true.
+func completionContext(r *http.Request) context.Context {
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		return withForceComplete(r.Context())
+	}
+	return r.Context()
+}
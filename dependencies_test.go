@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// newTasks returns n tasks in the Ongoing category, the first of which
+// will get ID first, each blocked by the tasks at the given offsets.
+func newTasks(first int, blockedBy ...[]int) []Task {
+	tasks := make([]Task, len(blockedBy))
+	for i, offsets := range blockedBy {
+		tasks[i] = Task{Title: "Task", Type: categories.Name(CategoryOngoing), Priority: "Medium"}
+		for _, offset := range offsets {
+			tasks[i].BlockedBy = append(tasks[i].BlockedBy, first+offset)
+		}
+	}
+	return tasks
+}
+
+func wantBlockedByError(t *testing.T, what string, err error) {
+	t.Helper()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 1 || invalid.Fields[0].Field != "blocked_by" {
+		t.Errorf("%s: error = %v, want a blocked_by field error", what, err)
+	}
+}
+
+func TestCreateManyBlockers(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+	first := createTask(t, ctx, Task{Title: "First"}).ID + 1
+
+	tests := []struct {
+		name      string
+		blockedBy [][]int // offsets from the first new ID
+	}{
+		{"self", [][]int{{0}}},
+		{"2-cycle", [][]int{{1}, {0}}},
+		{"3-cycle", [][]int{{1}, {2}, {0}}},
+		{"3-cycle behind a chain", [][]int{{1}, {2}, {3}, {1}}},
+		{"beyond the batch", [][]int{{}, {2}}},
+	}
+	for _, tt := range tests {
+		_, err := taskManager.CreateMany(ctx, newTasks(first, tt.blockedBy...))
+		wantBlockedByError(t, tt.name, err)
+	}
+	if n := len(taskManager.List()); n != 1 {
+		t.Fatalf("rejected batches stored tasks: %d tasks, want 1", n)
+	}
+
+	// Tasks in a batch may block each other, in either order, and existing tasks
+	created, err := taskManager.CreateMany(ctx, newTasks(first, []int{1}, []int{-1}, []int{0, 1}))
+	if err != nil {
+		t.Fatalf("CreateMany with blockers in the batch: %v", err)
+	}
+	if got := created[2].BlockedBy; len(got) != 2 || got[0] != first || got[1] != first+1 {
+		t.Errorf("blockers = %v, want [%d %d]", got, first, first+1)
+	}
+}
+
+func TestCreateManyCompletedBehindOpenBlocker(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+	first := createTask(t, ctx, Task{Title: "First"}).ID + 1
+
+	tasks := newTasks(first, nil, []int{0})
+	tasks[1].Completed = true
+	if _, err := taskManager.CreateMany(ctx, tasks); !errors.Is(err, ErrBlocked) {
+		t.Errorf("completed task blocked by an open one in its batch: error = %v, want %v", err, ErrBlocked)
+	}
+	if _, err := taskManager.CreateMany(withForceComplete(ctx), tasks); err != nil {
+		t.Errorf("forced completion: %v", err)
+	}
+}
+
+func TestUpdateRejectsBlockerCycles(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+	a := createTask(t, ctx, Task{Title: "A"})
+	b := createTask(t, ctx, Task{Title: "B", BlockedBy: []int{a.ID}})
+	c := createTask(t, ctx, Task{Title: "C", BlockedBy: []int{b.ID}})
+
+	for _, tt := range []struct {
+		name      string
+		task      Task
+		blockedBy []int
+	}{
+		{"self", a, []int{a.ID}},
+		{"2-cycle", a, []int{b.ID}},
+		{"3-cycle", a, []int{c.ID}},
+	} {
+		tt.task.BlockedBy = tt.blockedBy
+		_, err := taskManager.Update(ctx, tt.task.ID, tt.task, tt.task.Version)
+		wantBlockedByError(t, tt.name, err)
+	}
+
+	c.BlockedBy = []int{a.ID, b.ID}
+	if _, err := taskManager.Update(ctx, c.ID, c, c.Version); err != nil {
+		t.Errorf("adding a blocker that is no cycle: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+)
+
+// dueSoonWindow is how close to its due date an open task is flagged as due soon.
+const dueSoonWindow = 24 * time.Hour
+
+// deriveDueAt fills in DueAt from the time window of the task's category
+// when the task does not already have one.
+func deriveDueAt(task *Task) {
+	if task.DueAt != nil {
+		return
+	}
+	if c, ok := categories.Named(task.Type); ok {
+		if window, ok := c.Window(); ok {
+			due := task.CreatedAt.Add(window)
+			task.DueAt = &due
+		}
+	}
+}
+
+// TaskView is a task as returned by the API, with its deadline state
+// worked out for the current time, a summary of its discussion and its
+// recurrence in words.
+type TaskView struct {
+	Task
+	Overdue      bool      `json:"overdue"`
+	DueSoon      bool      `json:"due_soon"`
+	CommentCount int       `json:"comment_count"`
+	Repeats      string    `json:"repeats,omitempty"`
+	Subtasks     []int     `json:"subtasks,omitempty"`
+	Progress     *Progress `json:"progress,omitempty"`
+
+	// Blocked is set on open tasks waiting on OpenBlockers; Blocking lists
+	// the tasks that wait on this one.
+	Blocked      bool  `json:"blocked"`
+	OpenBlockers []int `json:"open_blockers,omitempty"`
+	Blocking     []int `json:"blocking,omitempty"`
+
+	ResidentName string `json:"resident_name,omitempty"`
+}
+
+// viewTask computes the deadline flags of a task at time now and fills in
+// its owner names, comment count, recurrence description, subtasks,
+// progress, dependencies and resident.
+func viewTask(task Task, now time.Time) TaskView {
+	v := TaskView{Task: task, CommentCount: comments.Count(task.ID), Repeats: describeRRule(task.Recurrence)}
+	children := taskManager.Children(task.ID)
+	for _, child := range children {
+		v.Subtasks = append(v.Subtasks, child.ID)
+	}
+	v.Progress = taskProgress(task, children)
+	open, blocks := taskManager.Blockers(task)
+	for _, t := range open {
+		v.OpenBlockers = append(v.OpenBlockers, t.ID)
+	}
+	v.Blocked = !task.Completed && len(open) > 0
+	v.Blocking = blocks
+	v.ResidentName = residents.Name(task.ResidentID)
+	if len(task.Owners) > 0 {
+		// Show current names, even if someone was renamed since
+		v.Owner = people.DisplayName(task.Owners)
+	}
+	if task.Completed || task.DueAt == nil {
+		return v
+	}
+	v.Overdue = now.After(*task.DueAt)
+	v.DueSoon = !v.Overdue && task.DueAt.Sub(now) <= dueSoonWindow
+	return v
+}
+
+// viewTasks computes deadline flags for a list of tasks.
+func viewTasks(tasks []Task, now time.Time) []TaskView {
+	views := make([]TaskView, len(tasks))
+	for i, task := range tasks {
+		views[i] = viewTask(task, now)
+	}
+	return views
+}
+
+// parseDueTime accepts an RFC 3339 timestamp or a plain date, which is
+// taken as the start of that day in local time.
+func parseDueTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// APIError is the JSON body of every error response from the API.
+type APIError struct {
+	// Code is a stable, machine-readable name for the kind of error,
+	// e.g. "not_found" or "validation_failed".
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes a problem with one field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request body fails validation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// writeError sends a JSON error with a code derived from the status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, APIError{Code: errorCode(status), Message: message})
+}
+
+// writeValidationError sends a 422 listing every invalid field.
+func writeValidationError(w http.ResponseWriter, err *ValidationError) {
+	writeAPIError(w, http.StatusUnprocessableEntity, APIError{
+		Code:    "validation_failed",
+		Message: "The request has invalid fields",
+		Fields:  err.Fields,
+	})
+}
+
+// methodNotAllowed sends a 405 naming the methods the resource supports.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, r.Method+" is not supported here")
+}
+
+func writeAPIError(w http.ResponseWriter, status int, body APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// errorCode turns a status such as 404 into a code such as "not_found".
+func errorCode(status int) string {
+	switch status {
+	case http.StatusInternalServerError:
+		return "internal_error"
+	case http.StatusUnprocessableEntity:
+		return "validation_failed"
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	ExportCSV      = "csv"
+	ExportJSON     = "json"
+	ExportMarkdown = "md"
+	ExportHTML     = "html"
+)
+
+// exportTypes are the Content-Type of each export format.
+var exportTypes = map[string]string{
+	ExportCSV:      "text/csv; charset=utf-8",
+	ExportJSON:     "application/json",
+	ExportMarkdown: "text/markdown; charset=utf-8",
+	ExportHTML:     "text/html; charset=utf-8",
+}
+
+// exportColumns are the headings of a CSV export. They match the column
+// names POST /api/import recognises, so an export can be imported again.
+var exportColumns = []string{"ID", "Title", "Type", "Owner", "Priority", "Status", "Completed", "Due", "Created", "Notes"}
+
+// exportGroup is the tasks of one type, for the grouped formats.
+type exportGroup struct {
+	Type  string
+	Color string
+	Tasks []TaskView
+}
+
+// groupByType splits tasks by type in category order, keeping their order
+// within each group. Types that are no longer categories come last.
+func groupByType(views []TaskView) []exportGroup {
+	var groups []exportGroup
+	index := map[string]int{}
+	for _, c := range categories.List() {
+		index[c.Name] = len(groups)
+		groups = append(groups, exportGroup{Type: c.Name, Color: c.Color})
+	}
+	for _, v := range views {
+		i, ok := index[v.Type]
+		if !ok {
+			i = len(groups)
+			index[v.Type] = i
+			groups = append(groups, exportGroup{Type: v.Type, Color: defaultColor})
+		}
+		groups[i].Tasks = append(groups[i].Tasks, v)
+	}
+	nonEmpty := groups[:0]
+	for _, g := range groups {
+		if len(g.Tasks) > 0 {
+			nonEmpty = append(nonEmpty, g)
+		}
+	}
+	return nonEmpty
+}
+
+// statusName returns the name of a task's workflow status.
+func statusName(v TaskView) string {
+	if s, ok := workflow.Lookup(v.WorkflowStatus); ok {
+		return s.Name
+	}
+	return v.WorkflowStatus
+}
+
+// dueDate formats a due date for people, or "" if there is none.
+func dueDate(v TaskView) string {
+	if v.DueAt == nil {
+		return ""
+	}
+	return v.DueAt.In(time.Local).Format("2006-01-02")
+}
+
+// csvCell keeps text from being read as a formula when the CSV is opened
+// in a spreadsheet, by putting a quote before a leading =, +, -, @, tab or
+// carriage return.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeExportCSV writes one row per task under exportColumns.
+func writeExportCSV(w http.ResponseWriter, views []TaskView) error {
+	out := csv.NewWriter(w)
+	out.Write(exportColumns)
+	for _, v := range views {
+		completed := "no"
+		if v.Completed {
+			completed = "yes"
+		}
+		out.Write([]string{
+			strconv.Itoa(v.ID), csvCell(v.Title), csvCell(v.Type), csvCell(v.Owner), v.Priority, csvCell(statusName(v)), completed,
+			dueDate(v), v.CreatedAt.In(time.Local).Format("2006-01-02"), csvCell(v.Notes),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// markdownCell makes text safe to put in a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// writeExportMarkdown writes a table of tasks for each type, ready to paste
+// into an email or a meeting note.
+func writeExportMarkdown(w http.ResponseWriter, title string, views []TaskView, now time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n_%d tasks, exported %s_\n", title, len(views), now.In(time.Local).Format("2 Jan 2006 15:04"))
+	for _, g := range groupByType(views) {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownCell(g.Type))
+		b.WriteString("| # | Task | Owner | Priority | Due | Status |\n")
+		b.WriteString("|---:|---|---|---|---|---|\n")
+		for _, v := range g.Tasks {
+			task := markdownCell(v.Title)
+			if v.Completed {
+				task = "~~" + task + "~~"
+			}
+			due := dueDate(v)
+			if v.Overdue {
+				due += " **overdue**"
+			}
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n",
+				v.ID, task, markdownCell(v.Owner), v.Priority, due, markdownCell(statusName(v)))
+		}
+	}
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
+
+// exportPage is the printable HTML report. Browsers can save it as a PDF.
+var exportPage = template.Must(template.New("export").Funcs(template.FuncMap{
+	"due":    dueDate,
+	"status": statusName,
+	"css":    func(s string) template.CSS { return template.CSS(s) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Title}}</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            color: #1e293b;
+            margin: 30px;
+            font-size: 13px;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin: 0 0 5px;
+        }
+        .summary {
+            color: #64748b;
+            margin-bottom: 20px;
+        }
+        h2 {
+            font-size: 1.1rem;
+            border-left: 5px solid;
+            padding-left: 8px;
+            margin: 25px 0 8px;
+            break-after: avoid;
+        }
+        table {
+            width: 100%;
+            border-collapse: collapse;
+        }
+        th, td {
+            text-align: left;
+            padding: 6px 8px;
+            border-bottom: 1px solid #e5e7eb;
+            vertical-align: top;
+        }
+        th {
+            background: #f8fafc;
+            font-weight: 600;
+        }
+        tr {
+            break-inside: avoid;
+        }
+        .done td {
+            color: #94a3b8;
+            text-decoration: line-through;
+        }
+        .overdue {
+            color: #dc2626;
+            font-weight: 600;
+        }
+        .notes {
+            color: #64748b;
+            white-space: pre-line;
+        }
+        @media print {
+            body {
+                margin: 0;
+            }
+            .no-print {
+                display: none;
+            }
+        }
+    </style>
+</head>
+<body>
+    <button class="no-print" onclick="window.print()">Print or save as PDF</button>
+    <h1>{{.Title}}</h1>
+    <div class="summary">{{len .Tasks}} tasks · exported {{.Now.Format "2 Jan 2006 15:04"}}</div>
+    {{range .Groups}}
+    <h2 style="border-color: {{css .Color}}">{{.Type}}</h2>
+    <table>
+        <tr><th>#</th><th>Task</th><th>Owner</th><th>Priority</th><th>Due</th><th>Status</th></tr>
+        {{range .Tasks}}
+        <tr{{if .Completed}} class="done"{{end}}>
+            <td>{{.ID}}</td>
+            <td>{{.Title}}{{if .Notes}}<div class="notes">{{.Notes}}</div>{{end}}</td>
+            <td>{{.Owner}}</td>
+            <td>{{.Priority}}</td>
+            <td{{if .Overdue}} class="overdue"{{end}}>{{due .}}</td>
+            <td>{{status .}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{else}}
+    <p>No tasks match.</p>
+    {{end}}
+</body>
+</html>
+`))
+
+// exportHandler serves GET /api/tasks/export?format=csv|json|md|html. It
+// takes the filters and sort order of GET /api/tasks, including owner=me,
+// and exports every matching task. With ?download=true browsers save the
+// file instead of showing it.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET", "HEAD")
+		return
+	}
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+	if format == "markdown" {
+		format = ExportMarkdown
+	}
+	contentType, ok := exportTypes[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q; use csv, json, md or html", format))
+		return
+	}
+	download, _ := strconv.ParseBool(params.Get("download"))
+	for _, name := range []string{"format", "download", "limit", "cursor"} {
+		params.Del(name)
+	}
+	resolveOwnerMe(r.Context(), params)
+	query, err := parseTaskQuery(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	views, _, _ := query.Apply(viewTasks(taskManager.List(), now))
+	title := "AMSKU Action Items"
+
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="tasks-%s.%s"`, disposition, now.In(time.Local).Format("2006-01-02"), format))
+
+	switch format {
+	case ExportCSV:
+		err = writeExportCSV(w, views)
+	case ExportJSON:
+		err = json.NewEncoder(w).Encode(views)
+	case ExportMarkdown:
+		err = writeExportMarkdown(w, title, views, now)
+	case ExportHTML:
+		err = exportPage.Execute(w, struct {
+			Title  string
+			Now    time.Time
+			Tasks  []TaskView
+			Groups []exportGroup
+		}{title, now.In(time.Local), views, groupByType(views)})
+	}
+	if err != nil {
+		log.Printf("export: writing %s: %v", format, err)
+	}
+}
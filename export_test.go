@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteExportCSVEscapesFormulas(t *testing.T) {
+	newTestStore(t)
+	views := []TaskView{{Task: Task{
+		ID:    1,
+		Title: `=HYPERLINK("http://evil.example","Click")`,
+		Owner: "@ana",
+		Notes: "-2+3",
+	}}}
+	rec := httptest.NewRecorder()
+	if err := writeExportCSV(rec, views); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := rows[1]
+	for i, want := range map[int]string{1: `'=HYPERLINK("http://evil.example","Click")`, 3: "'@ana", 9: "'-2+3"} {
+		if row[i] != want {
+			t.Errorf("%s = %q, want %q", rows[0][i], row[i], want)
+		}
+	}
+
+	for _, s := range []string{"Fix the gate", "", "a=b", "\tTabbed", "\rReturn", "+1"} {
+		got := csvCell(s)
+		if escaped := got != s; escaped != (s != "" && (s[0] == '\t' || s[0] == '\r' || s[0] == '+')) {
+			t.Errorf("csvCell(%q) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// utterance is one line of speech from a transcript.
+type utterance struct {
+	Speaker string
+	Time    string // cue start time for VTT transcripts
+	Text    string
+}
+
+var (
+	vttTiming     = regexp.MustCompile(`^(\d{1,2}:)?\d{2}:\d{2}[.,]\d{3}\s+-->`)
+	vttVoice      = regexp.MustCompile(`<v(?:\.[^ >]*)?\s+([^>]+)>`)
+	vttTag        = regexp.MustCompile(`</?[^>]+>`)
+	speakerPrefix = regexp.MustCompile(`^([A-Z][\w'.-]*(?:\s+[A-Z][\w'.-]*){0,2})\s*:\s+(.+)$`)
+
+	// Explicit markers such as "Action item: update the schedule".
+	markerRule = regexp.MustCompile(`(?i)\b(?:action items?|to-?do|next steps?|follow[- ]up)\s*[:\-]\s*(.+)`)
+	// Commitments such as "Tariro will fix the schedule" or "I'll send the email".
+	commitRule = regexp.MustCompile(`\b(I|We|we|[A-Z][a-z]+)(?:\s+will|['’]ll|\s+is going to|\s+are going to|\s+needs? to|\s+has to|\s+should)\s+(.+)`)
+	// Proposals such as "Let's move the meeting to Wednesday".
+	proposalRule = regexp.MustCompile(`(?i)\blet'?s\s+(.+)`)
+
+	highPriorityHint = regexp.MustCompile(`(?i)\b(urgent|asap|as soon as possible|immediately|critical|today|tonight|tomorrow|end of (the )?day)\b`)
+	lowPriorityHint  = regexp.MustCompile(`(?i)\b(eventually|low priority|nice to have|when (we|you) (get|have) (a )?chance|someday)\b`)
+
+	immediateHint     = regexp.MustCompile(`(?i)\b(asap|immediately|today|tonight|tomorrow|24|48 hours|end of (the )?day)\b`)
+	communicationHint = regexp.MustCompile(`(?i)\b(e-?mail|call|tell|let \w+ know|coordinate|hand ?off|communicate|introduce|notify|reach out)\b`)
+	ongoingHint       = regexp.MustCompile(`(?i)\b(every|weekly|monthly|ongoing|keep track|monitor|track)\b`)
+)
+
+// parseTranscript splits a plain-text or WebVTT transcript into utterances.
+func parseTranscript(text string) []utterance {
+	var (
+		utterances []utterance
+		cueTime    string
+		isVTT      = strings.HasPrefix(strings.TrimSpace(text), "WEBVTT")
+		inNote     bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			inNote = false
+			continue
+		}
+
+		if isVTT {
+			switch {
+			case inNote, strings.HasPrefix(line, "WEBVTT"):
+				continue
+			case strings.HasPrefix(line, "NOTE"), strings.HasPrefix(line, "STYLE"), strings.HasPrefix(line, "REGION"):
+				inNote = true
+				continue
+			case vttTiming.MatchString(line):
+				cueTime = strings.Fields(line)[0]
+				continue
+			case isDigits(line):
+				// cue identifier
+				continue
+			}
+		}
+
+		u := utterance{Time: cueTime, Text: line}
+		if m := vttVoice.FindStringSubmatch(line); m != nil {
+			u.Speaker = strings.TrimSpace(m[1])
+		}
+		u.Text = strings.TrimSpace(vttTag.ReplaceAllString(u.Text, ""))
+		if u.Speaker == "" {
+			if m := speakerPrefix.FindStringSubmatch(u.Text); m != nil {
+				u.Speaker, u.Text = m[1], m[2]
+			}
+		}
+		if u.Text != "" {
+			utterances = append(utterances, u)
+		}
+	}
+	return utterances
+}
+
+// extractDraftTasks runs the rule-based extractor over a transcript and
+// returns a draft task for every action item it recognises. owners are the
+// names of people already known to the task list.
+func extractDraftTasks(text string, owners []string) []DraftTask {
+	var (
+		drafts []DraftTask
+		seen   = map[string]bool{}
+	)
+	for _, u := range parseTranscript(text) {
+		for _, sentence := range splitSentences(u.Text) {
+			action, subject, ok := matchAction(sentence, owners)
+			if !ok {
+				continue
+			}
+			title := draftTitle(action)
+			if title == "" || seen[strings.ToLower(title)] {
+				continue
+			}
+			seen[strings.ToLower(title)] = true
+
+			priority := "Medium"
+			if highPriorityHint.MatchString(sentence) {
+				priority = "High"
+			} else if lowPriorityHint.MatchString(sentence) {
+				priority = "Low"
+			}
+
+			source := sentence
+			if u.Speaker != "" {
+				source = u.Speaker + ": " + sentence
+			}
+			if u.Time != "" {
+				source = "[" + u.Time + "] " + source
+			}
+
+			drafts = append(drafts, DraftTask{
+				ID:      len(drafts) + 1,
+				Source:  source,
+				Speaker: u.Speaker,
+				Status:  DraftPending,
+				Task: Task{
+					Title:    title,
+					Type:     guessType(sentence),
+					Owner:    guessOwner(sentence, subject, u.Speaker, owners),
+					Priority: priority,
+					Notes:    "From transcript: " + source,
+				},
+			})
+		}
+	}
+	return drafts
+}
+
+// matchAction reports the action phrase of a sentence that looks like an
+// action item, along with the grammatical subject if there is one.
+// Commitments only count when made by the speaker, the team or a known owner.
+func matchAction(sentence string, owners []string) (action, subject string, ok bool) {
+	if m := markerRule.FindStringSubmatch(sentence); m != nil {
+		return m[1], "", true
+	}
+	if m := commitRule.FindStringSubmatch(sentence); m != nil {
+		if m[1] == "I" || strings.EqualFold(m[1], "we") || slices.ContainsFunc(owners, func(o string) bool {
+			return strings.EqualFold(o, m[1])
+		}) {
+			return m[2], m[1], true
+		}
+	}
+	if m := proposalRule.FindStringSubmatch(sentence); m != nil {
+		return m[1], "", true
+	}
+	return "", "", false
+}
+
+// guessOwner picks the task owner: the subject of the sentence when it is a
+// known owner (or the speaker for "I"), otherwise every known owner named
+// in the sentence, falling back to the speaker if they are a known owner.
+func guessOwner(sentence, subject, speaker string, owners []string) string {
+	if subject == "I" && speaker != "" {
+		return speaker
+	}
+	for _, owner := range owners {
+		if strings.EqualFold(owner, subject) {
+			return owner
+		}
+	}
+
+	var named []string
+	for _, owner := range owners {
+		if containsWord(sentence, owner) {
+			named = append(named, owner)
+		}
+	}
+	if len(named) == 0 && slices.Contains(owners, speaker) {
+		return speaker
+	}
+	return strings.Join(named, " & ")
+}
+
+// guessType maps time and activity hints in a sentence onto a task type.
+func guessType(sentence string) string {
+	switch {
+	case immediateHint.MatchString(sentence):
+		return categories.Name(CategoryImmediate)
+	case communicationHint.MatchString(sentence):
+		return categories.Name(CategoryCommunication)
+	case ongoingHint.MatchString(sentence):
+		return categories.Name(CategoryOngoing)
+	default:
+		return categories.Name(CategoryProcess)
+	}
+}
+
+// draftTitle turns an action phrase into a short, capitalised task title.
+func draftTitle(action string) string {
+	title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(action), ".!?,;:"))
+	const maxLen = 100
+	if utf8.RuneCountInString(title) > maxLen {
+		title = truncate(title, maxLen)
+		// End on a whole word if there is one
+		if cut := strings.LastIndex(title, " "); cut > 0 {
+			title = title[:cut] + "…"
+		}
+	}
+	runes := []rune(title)
+	if len(runes) == 0 {
+		return ""
+	}
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// splitSentences breaks text after '.', '!' or '?' followed by a space.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '.', '!', '?':
+			if i+1 == len(text) || text[i+1] == ' ' {
+				if s := strings.TrimSpace(text[start : i+1]); s != "" {
+					sentences = append(sentences, s)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// containsWord reports whether word occurs in text on word boundaries,
+// ignoring case.
+func containsWord(text, word string) bool {
+	re, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
+	return err == nil && re.MatchString(text)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
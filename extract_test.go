@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDraftTitleCutsWholeRunes(t *testing.T) {
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{"fix the gate.", "Fix the gate"},
+		{strings.Repeat("é", 150), "É" + strings.Repeat("é", 98) + "…"},
+		{strings.Repeat("a", 98) + " ünïcödé wörds", "A" + strings.Repeat("a", 97) + "…"},
+		{"order " + strings.Repeat("ü", 120), "Order…"},
+	}
+	for _, tt := range tests {
+		got := draftTitle(tt.action)
+		if !utf8.ValidString(got) || got != tt.want {
+			t.Errorf("draftTitle(%.20q…) = %q, want %q", tt.action, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestStore points the package's registries at an empty JSON store in a
+// temporary directory, as main does at startup, and returns the store.
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	store, err := openStore("json", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	people, err = NewPeopleRegistry(store)
+	must(err)
+	categories, err = NewCategoryRegistry(store)
+	must(err)
+	workflow, err = NewWorkflow(store)
+	must(err)
+	residents, err = NewResidentRegistry(store)
+	must(err)
+	taskManager = NewTaskManager(store, people)
+	history, err = NewHistoryLog(store)
+	must(err)
+	comments, err = NewCommentStore(store)
+	must(err)
+	transcriptManager, err = NewTranscriptManager(store, taskManager)
+	must(err)
+	accounts, err = NewAccountStore(store)
+	must(err)
+	tokens, err = NewTokenStore(store)
+	must(err)
+	calendly, err = NewCalendlyIntegration(store)
+	must(err)
+	webhooks, err = NewWebhookRegistry(store)
+	must(err)
+	return store
+}
+
+// addPerson adds someone to the People registry.
+func addPerson(t *testing.T, name, email string) Person {
+	t.Helper()
+	p, err := people.Create(Person{Name: name, Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// testPassword is the password of every account made by addAccount.
+const testPassword = "secretpass1"
+
+// addAccount adds an account, and a person of the same name, with the
+// given role.
+func addAccount(t *testing.T, username string, role Role) Account {
+	t.Helper()
+	account, err := createAccount(username, testPassword, "", username, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+// createTask creates a task in the Ongoing category, which sets no due
+// date of its own.
+func createTask(t *testing.T, ctx context.Context, task Task) Task {
+	t.Helper()
+	if task.Type == "" {
+		task.Type = categories.Name(CategoryOngoing)
+	}
+	if task.Priority == "" {
+		task.Priority = "Medium"
+	}
+	task, err := taskManager.Create(ctx, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+// newTestServer serves the app's routes over an empty store.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	newTestStore(t)
+	srv := httptest.NewServer(routes())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testClient calls a test server as one browser or script would: with its
+// own cookies, and the CSRF token or API token it was given.
+type testClient struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+	csrf   string
+	bearer string
+	header http.Header // of the last response
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &testClient{t: t, srv: srv, client: client}
+}
+
+// signedIn returns a client signed in to the account, holding its CSRF token.
+func signedIn(t *testing.T, srv *httptest.Server, username string) *testClient {
+	t.Helper()
+	c := newTestClient(t, srv)
+	var session sessionView
+	if status := c.do("POST", "/api/session", map[string]string{"username": username, "password": testPassword}, &session); status != http.StatusOK {
+		t.Fatalf("signing in as %s: status %d", username, status)
+	}
+	c.csrf = session.CSRFToken
+	return c
+}
+
+// withToken returns a client that sends secret as a bearer token.
+func withToken(t *testing.T, srv *httptest.Server, secret string) *testClient {
+	c := newTestClient(t, srv)
+	c.bearer = secret
+	return c
+}
+
+// do sends body as JSON, decodes the response into out if it is not nil,
+// and returns the status code.
+func (c *testClient) do(method, path string, body, out any) int {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.srv.URL+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.csrf != "" {
+		req.Header.Set(csrfHeader, c.csrf)
+	}
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	c.header = resp.Header
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// failingStore is a Store whose saves of one collection fail.
+type failingStore struct {
+	Store
+	collection string
+}
+
+func (s failingStore) Save(collection string, v any) error {
+	if collection == s.collection {
+		return errors.New("disk full")
+	}
+	return s.Store.Save(collection, v)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task event actions
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionToggled = "toggled"
+	ActionDeleted = "deleted"
+)
+
+// TaskEvent records one change to a task. Events are never modified once
+// they have been recorded.
+type TaskEvent struct {
+	ID      int           `json:"id"`
+	TaskID  int           `json:"task_id"`
+	Title   string        `json:"title"`
+	Action  string        `json:"action"`
+	Actor   string        `json:"actor"`
+	At      time.Time     `json:"at"`
+	Changes []FieldChange `json:"changes,omitempty"`
+
+	// Task is the task after the change, or before it for deletions. It is
+	// for listeners and is not kept in the history.
+	Task *Task `json:"-"`
+}
+
+// FieldChange is the before and after value of one task field.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// HistoryLog is the append-only audit log of task events.
+type HistoryLog struct {
+	mu     sync.RWMutex
+	store  Store
+	events []TaskEvent
+	nextID int
+	queue  chan TaskEvent // for Run to record
+}
+
+type historySnapshot struct {
+	Events []TaskEvent `json:"events"`
+	NextID int         `json:"next_id"`
+}
+
+// history holds the audit log of task changes
+var history *HistoryLog
+
+// NewHistoryLog loads the audit log from store.
+func NewHistoryLog(store Store) (*HistoryLog, error) {
+	snap := historySnapshot{Events: []TaskEvent{}, NextID: 1}
+	if _, err := store.Load("history", &snap); err != nil {
+		return nil, err
+	}
+	return &HistoryLog{store: store, events: snap.Events, nextID: snap.NextID, queue: make(chan TaskEvent, 256)}, nil
+}
+
+// Record appends events to the log in one save.
+func (h *HistoryLog) Record(batch ...TaskEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := h.events[:len(h.events):len(h.events)]
+	nextID := h.nextID
+	for _, event := range batch {
+		event.ID = nextID
+		events = append(events, event)
+		nextID++
+	}
+	if err := h.store.Save("history", historySnapshot{Events: events, NextID: nextID}); err != nil {
+		return err
+	}
+	h.events, h.nextID = events, nextID
+	return nil
+}
+
+// Notify queues a task event for the log. It is a TaskManager listener, so
+// it must not block or call back into the manager; Run does the work.
+func (h *HistoryLog) Notify(event TaskEvent) {
+	select {
+	case h.queue <- event:
+	default:
+		log.Printf("history: queue full, dropping %s of task %d", event.Action, event.TaskID)
+	}
+}
+
+// Run records queued events until the process exits. Events queued while
+// the last ones were saved are recorded together.
+func (h *HistoryLog) Run() {
+	for event := range h.queue {
+		batch := []TaskEvent{event}
+		for len(h.queue) > 0 {
+			batch = append(batch, <-h.queue)
+		}
+		if err := h.Record(batch...); err != nil {
+			log.Printf("history: recording %d events: %v", len(batch), err)
+		}
+	}
+}
+
+// ForTask returns the events of one task, oldest first.
+func (h *HistoryLog) ForTask(taskID int) []TaskEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	events := []TaskEvent{}
+	for _, e := range h.events {
+		if e.TaskID == taskID {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Recent returns up to limit events, newest first, optionally only those
+// made by actor.
+func (h *HistoryLog) Recent(actor string, limit int) []TaskEvent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	events := []TaskEvent{}
+	for i := len(h.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if actor == "" || strings.EqualFold(h.events[i].Actor, actor) {
+			events = append(events, h.events[i])
+		}
+	}
+	return events
+}
+
+// diffTasks lists the fields that differ between two versions of a task.
+// A nil before lists every field that is set on after.
+func diffTasks(before, after *Task) []FieldChange {
+	type field struct {
+		name string
+		get  func(t *Task) any
+	}
+	fields := []field{
+		{"title", func(t *Task) any { return t.Title }},
+		{"type", func(t *Task) any { return t.Type }},
+		{"owners", func(t *Task) any { return t.Owners }},
+		{"priority", func(t *Task) any { return t.Priority }},
+		{"completed", func(t *Task) any { return t.Completed }},
+		{"notes", func(t *Task) any { return t.Notes }},
+		{"due_at", func(t *Task) any { return optionalTime(t.DueAt) }},
+		{"recurrence", func(t *Task) any { return t.Recurrence }},
+		{"parent_id", func(t *Task) any { return t.ParentID }},
+		{"checklist", func(t *Task) any { return checklistSummary(t.Checklist) }},
+		{"auto_complete", func(t *Task) any { return t.AutoComplete }},
+		{"blocked_by", func(t *Task) any { return t.BlockedBy }},
+		{"workflow_status", func(t *Task) any { return t.WorkflowStatus }},
+		{"resident_id", func(t *Task) any { return t.ResidentID }},
+	}
+
+	var changes []FieldChange
+	for _, f := range fields {
+		var from any
+		if before != nil {
+			from = f.get(before)
+		}
+		to := f.get(after)
+		if before == nil && reflect.ValueOf(to).IsZero() {
+			continue
+		}
+		if before != nil && reflect.DeepEqual(from, to) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: f.name, From: from, To: to})
+	}
+	return changes
+}
+
+// optionalTime makes a timestamp comparable with reflect.DeepEqual, which
+// would otherwise tell apart equal instants in different locations.
+func optionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339Nano)
+	return &s
+}
+
+// checklistSummary lists checklist items as "[x] text" or "[ ] text".
+func checklistSummary(items []ChecklistItem) []string {
+	var summary []string
+	for _, item := range items {
+		box := "[ ] "
+		if item.Done {
+			box = "[x] "
+		}
+		summary = append(summary, box+item.Text)
+	}
+	return summary
+}
+
+type actorKey struct{}
+
+// withActor returns a context carrying the name of whoever is making a change.
+// requireLogin sets it to the signed-in person.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the name of whoever is making a change.
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// historyHandler serves /api/history, the audit log across all tasks
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+			return
+		}
+		limit = n
+	}
+	json.NewEncoder(w).Encode(history.Recent(r.URL.Query().Get("actor"), limit))
+}
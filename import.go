@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize limits the file sent to POST /api/import, in bytes.
+const maxImportSize = 5 << 20
+
+// Import formats
+const (
+	ImportICS = "ics"
+	ImportCSV = "csv"
+)
+
+// importFields are the task fields a CSV column can be mapped onto.
+var importFields = []string{"title", "type", "owner", "priority", "notes", "due_at", "completed"}
+
+// importAliases are the column headings, once lowercased and stripped of
+// everything but letters and digits, that map onto each field without an
+// explicit mapping.
+var importAliases = map[string][]string{
+	"title":     {"title", "task", "name", "summary", "actionitem"},
+	"type":      {"type", "category", "tasktype"},
+	"owner":     {"owner", "owners", "assignee", "assignedto", "who"},
+	"priority":  {"priority"},
+	"notes":     {"notes", "note", "description", "details"},
+	"due_at":    {"dueat", "due", "duedate", "deadline"},
+	"completed": {"completed", "done", "status"},
+}
+
+// ImportRequest is the body of POST /api/import.
+type ImportRequest struct {
+	Format  string            `json:"format"` // ics or csv; guessed from the content if empty
+	Content string            `json:"content"`
+	Mapping map[string]string `json:"mapping"` // task field to CSV column heading
+	// Defaults fills in the type, owner and priority of rows without them.
+	Defaults struct {
+		Type     string `json:"type"`
+		Owner    string `json:"owner"`
+		Priority string `json:"priority"`
+	} `json:"defaults"`
+	DryRun bool `json:"dry_run"`
+}
+
+// ImportRow is one task read from an import file.
+type ImportRow struct {
+	Row          int          `json:"row"` // CSV line or VTODO number, from 1
+	Task         Task         `json:"task"`
+	DuplicateOf  int          `json:"duplicate_of,omitempty"`  // existing task with the same title
+	DuplicateRow int          `json:"duplicate_row,omitempty"` // earlier row with the same title
+	Errors       []FieldError `json:"errors,omitempty"`
+}
+
+// Skipped reports whether the row will not be imported.
+func (r ImportRow) Skipped() bool {
+	return r.DuplicateOf != 0 || r.DuplicateRow != 0 || len(r.Errors) > 0
+}
+
+// ImportResult previews or reports an import. Duplicates are skipped
+// without being checked; any other invalid row stops the whole import.
+type ImportResult struct {
+	Format     string            `json:"format"`
+	Columns    []string          `json:"columns,omitempty"` // CSV headings
+	Mapping    map[string]string `json:"mapping,omitempty"`
+	Rows       []ImportRow       `json:"rows"`
+	New        int               `json:"new"`
+	Duplicates int               `json:"duplicates"`
+	Invalid    int               `json:"invalid"`
+	Created    []int             `json:"created,omitempty"`
+}
+
+// readImport parses an import file into rows, applies the defaults and
+// flags invalid rows and duplicates.
+func readImport(req ImportRequest, existing []Task) (ImportResult, error) {
+	result := ImportResult{Format: req.Format}
+	if result.Format == "" {
+		result.Format = ImportCSV
+		if strings.HasPrefix(strings.TrimSpace(req.Content), "BEGIN:VCALENDAR") {
+			result.Format = ImportICS
+		}
+	}
+
+	var err error
+	switch result.Format {
+	case ImportICS:
+		result.Rows, err = parseICSTodos(req.Content)
+	case ImportCSV:
+		result.Columns, result.Mapping, result.Rows, err = parseCSVTasks(req.Content, req.Mapping)
+	default:
+		return result, fmt.Errorf("format must be %s or %s", ImportICS, ImportCSV)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	seen := map[string]int{}
+	for _, t := range existing {
+		seen[titleKey(t.Title)] = -t.ID
+	}
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		task := &row.Task
+		if task.Type == "" {
+			task.Type = req.Defaults.Type
+		}
+		if task.Owner == "" {
+			task.Owner = req.Defaults.Owner
+		}
+		if task.Priority == "" {
+			task.Priority = req.Defaults.Priority
+		}
+
+		switch prev := seen[titleKey(task.Title)]; {
+		case task.Title == "":
+		case prev < 0:
+			row.DuplicateOf = -prev
+			result.Duplicates++
+			continue
+		case prev > 0:
+			row.DuplicateRow = prev
+			result.Duplicates++
+			continue
+		}
+		seen[titleKey(task.Title)] = row.Row
+		if err := validateTask(*task); err != nil {
+			row.Errors = append(row.Errors, err.Fields...)
+		}
+		if _, unknown := people.Match(task.Owner); len(unknown) > 0 {
+			row.Errors = append(row.Errors, unknownOwnerError(unknown))
+		}
+		if len(row.Errors) > 0 {
+			result.Invalid++
+		} else {
+			result.New++
+		}
+	}
+	return result, nil
+}
+
+// titleKey folds case and spacing so near-identical titles match.
+func titleKey(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
+
+// parseCSVTasks reads a CSV file whose first line holds column headings.
+// Fields missing from mapping are mapped onto columns with a matching
+// heading. It returns the headings and the mapping it used.
+func parseCSVTasks(content string, mapping map[string]string) ([]string, map[string]string, []ImportRow, error) {
+	r := csv.NewReader(strings.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	// The reader skips blank lines, so each record's line is kept for
+	// its row number
+	var (
+		records [][]string
+		lines   []int
+	)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		records, lines = append(records, record), append(lines, line)
+	}
+	if len(records) == 0 {
+		return nil, nil, nil, errors.New("the CSV file is empty")
+	}
+	columns := records[0]
+
+	used := map[string]string{}
+	for field, column := range mapping {
+		if !slices.Contains(importFields, field) {
+			return nil, nil, nil, fmt.Errorf("cannot map onto unknown field %q", field)
+		}
+		if column != "" && !slices.Contains(columns, column) {
+			return nil, nil, nil, fmt.Errorf("mapping for %s names missing column %q", field, column)
+		}
+		used[field] = column
+	}
+	for _, field := range importFields {
+		if _, ok := used[field]; ok {
+			continue
+		}
+		// Earlier aliases win, so a "Completed" column beats a "Status" one
+		for _, alias := range importAliases[field] {
+			i := slices.IndexFunc(columns, func(column string) bool {
+				return nonSlug.ReplaceAllString(strings.ToLower(column), "") == alias
+			})
+			if i >= 0 {
+				used[field] = columns[i]
+				break
+			}
+		}
+	}
+	if used["title"] == "" {
+		return columns, used, nil, errors.New("no column is mapped to title")
+	}
+
+	var rows []ImportRow
+	for n, record := range records[1:] {
+		get := func(field string) string {
+			if i := slices.Index(columns, used[field]); i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+		row := ImportRow{Row: lines[n+1]}
+		row.Task = Task{
+			Title: get("title"),
+			Type:  get("type"),
+			Owner: get("owner"),
+			Notes: get("notes"),
+		}
+		if p := get("priority"); p != "" {
+			if rank := priorityRank(p); rank < len(taskPriorities) {
+				row.Task.Priority = taskPriorities[rank]
+			} else {
+				row.Task.Priority = p // reported by validateTask
+			}
+		}
+		if due := get("due_at"); due != "" {
+			if t, err := parseImportDate(due); err == nil {
+				row.Task.DueAt = &t
+			} else {
+				row.Errors = append(row.Errors, FieldError{Field: "due_at", Message: fmt.Sprintf("cannot read date %q", due)})
+			}
+		}
+		switch strings.ToLower(get("completed")) {
+		case "true", "yes", "y", "1", "x", "done", "completed", "complete":
+			row.Task.Completed = true
+		}
+		rows = append(rows, row)
+	}
+	return columns, used, rows, nil
+}
+
+// parseImportDate reads the date formats spreadsheets tend to produce. A
+// date without a time means the end of that day.
+func parseImportDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "1/2/2006", "1/2/06", "2 Jan 2006", "Jan 2, 2006"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Add(24*time.Hour - time.Second), nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "1/2/2006 15:04", "1/2/2006 3:04 PM"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unknown date format")
+}
+
+// icsProperty is one content line of an iCalendar file.
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// parseICSLines unfolds an iCalendar file and splits it into properties.
+func parseICSLines(content string) []icsProperty {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var props []icsProperty
+	for _, line := range lines {
+		head, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(head, ";")
+		p := icsProperty{Name: strings.ToUpper(parts[0]), Params: map[string]string{}, Value: value}
+		for _, param := range parts[1:] {
+			k, v, _ := strings.Cut(param, "=")
+			p.Params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+		props = append(props, p)
+	}
+	return props
+}
+
+// icsText undoes the escaping of an iCalendar TEXT value.
+func icsText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// icsTime reads a DATE or DATE-TIME value, honouring TZID. Dates mean the
+// end of that day.
+func icsTime(p icsProperty) (time.Time, error) {
+	loc := time.Local
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	if strings.HasSuffix(p.Value, "Z") {
+		return time.Parse(icsTimeFormat, p.Value)
+	}
+	if t, err := time.ParseInLocation("20060102T150405", p.Value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("20060102", p.Value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+// parseICSTodos reads the VTODO items of an iCalendar file. Other
+// components are ignored.
+func parseICSTodos(content string) ([]ImportRow, error) {
+	props := parseICSLines(content)
+	if len(props) == 0 || props[0].Name != "BEGIN" || !strings.EqualFold(props[0].Value, "VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+
+	var (
+		rows  []ImportRow
+		row   *ImportRow
+		depth int // nesting inside the current VTODO, e.g. a VALARM
+	)
+	for _, p := range props {
+		switch {
+		case p.Name == "BEGIN" && strings.EqualFold(p.Value, "VTODO") && row == nil:
+			row = &ImportRow{Row: len(rows) + 1}
+			continue
+		case row == nil:
+			continue
+		case p.Name == "BEGIN":
+			depth++
+			continue
+		case p.Name == "END" && depth > 0:
+			depth--
+			continue
+		case p.Name == "END":
+			rows = append(rows, *row)
+			row = nil
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch p.Name {
+		case "SUMMARY":
+			row.Task.Title = icsText(p.Value)
+		case "DESCRIPTION":
+			row.Task.Notes = icsText(p.Value)
+		case "DUE":
+			if t, err := icsTime(p); err == nil {
+				row.Task.DueAt = &t
+			} else {
+				row.Errors = append(row.Errors, FieldError{Field: "due_at", Message: fmt.Sprintf("cannot read date %q", p.Value)})
+			}
+		case "PRIORITY":
+			// 1-4 is high, 5 medium and 6-9 low; 0 means undefined
+			switch n, _ := strconv.Atoi(p.Value); {
+			case n >= 1 && n <= 4:
+				row.Task.Priority = "High"
+			case n == 5:
+				row.Task.Priority = "Medium"
+			case n >= 6 && n <= 9:
+				row.Task.Priority = "Low"
+			}
+		case "CATEGORIES":
+			for _, name := range strings.Split(p.Value, ",") {
+				if _, ok := categories.Named(icsText(name)); ok {
+					row.Task.Type = icsText(name)
+					break
+				}
+			}
+		case "STATUS":
+			row.Task.Completed = row.Task.Completed || strings.EqualFold(p.Value, "COMPLETED")
+		case "COMPLETED":
+			row.Task.Completed = true
+		case "RRULE":
+			if _, err := parseRRule(p.Value); err == nil {
+				row.Task.Recurrence = p.Value
+			}
+		}
+	}
+	return rows, nil
+}
+
+// importHandler serves POST /api/import. With dry_run set it only returns
+// the preview; otherwise it creates every new task in one change, or none
+// if any row is invalid.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !requirePermission(w, r, PermCreateTask) {
+		return
+	}
+
+	var req ImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+	result, err := readImport(req, taskManager.List())
+	if err != nil {
+		writeValidationError(w, &ValidationError{Fields: []FieldError{{Field: "content", Message: err.Error()}}})
+		return
+	}
+	if req.DryRun {
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	if result.Invalid > 0 {
+		var fields []FieldError
+		for _, row := range result.Rows {
+			for _, f := range row.Errors {
+				fields = append(fields, FieldError{Field: fmt.Sprintf("rows[%d].%s", row.Row, f.Field), Message: f.Message})
+			}
+		}
+		writeValidationError(w, &ValidationError{Fields: fields})
+		return
+	}
+
+	var tasks []Task
+	for _, row := range result.Rows {
+		if !row.Skipped() {
+			tasks = append(tasks, row.Task)
+		}
+	}
+	created, err := taskManager.CreateMany(r.Context(), tasks)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	for _, t := range created {
+		result.Created = append(result.Created, t.ID)
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// summarize writes out the parts of import rows the parsers fill in.
+func summarize(rows []ImportRow) string {
+	var lines []string
+	for _, row := range rows {
+		due := "-"
+		if row.Task.DueAt != nil {
+			due = row.Task.DueAt.UTC().Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("%d %q type=%q owner=%q priority=%q due=%s done=%v", row.Row, row.Task.Title, row.Task.Type, row.Task.Owner, row.Task.Priority, due, row.Task.Completed)
+		if row.Task.Notes != "" {
+			line += fmt.Sprintf(" notes=%q", row.Task.Notes)
+		}
+		if row.Task.Recurrence != "" {
+			line += " rrule=" + row.Task.Recurrence
+		}
+		for _, e := range row.Errors {
+			line += " error=" + e.Field
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseImportDate(t *testing.T) {
+	endOfDay := time.Date(2025, 3, 7, 23, 59, 59, 0, time.Local)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2025-03-07T10:30:00Z", time.Date(2025, 3, 7, 10, 30, 0, 0, time.UTC)},
+		{"2025-03-07", endOfDay},
+		{"3/7/2025", endOfDay},
+		{"3/7/25", endOfDay},
+		{"7 Mar 2025", endOfDay},
+		{"Mar 7, 2025", endOfDay},
+		{"2025-03-07 10:30", time.Date(2025, 3, 7, 10, 30, 0, 0, time.Local)},
+		{"3/7/2025 10:30", time.Date(2025, 3, 7, 10, 30, 0, 0, time.Local)},
+		{"3/7/2025 2:15 PM", time.Date(2025, 3, 7, 14, 15, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseImportDate(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseImportDate(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "tomorrow", "2025-13-01", "07.03.2025"} {
+		if got, err := parseImportDate(value); err == nil {
+			t.Errorf("parseImportDate(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestParseCSVTasks(t *testing.T) {
+	due := time.Date(2025, 3, 7, 23, 59, 59, 0, time.Local).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name    string
+		content string
+		mapping map[string]string
+		want    string // summarize of the rows
+		wantErr string
+	}{
+		{
+			name:    "headings by alias",
+			content: "Task,Assigned To,Priority,Due Date,Done\nFix the gate,Ana,high,2025-03-07,yes\n\nOrder bins,,,,\n",
+			want: `2 "Fix the gate" type="" owner="Ana" priority="High" due=` + due + ` done=true` + "\n" +
+				`4 "Order bins" type="" owner="" priority="" due=- done=false`,
+		},
+		{
+			name:    "completed beats status",
+			content: "Title,Status,Completed\nFix the gate,open,x\n",
+			want:    `2 "Fix the gate" type="" owner="" priority="" due=- done=true`,
+		},
+		{
+			name:    "explicit mapping",
+			content: "What,Who,Notes\nFix the gate,Ana,Hinges are rusty\n",
+			mapping: map[string]string{"title": "What", "owner": "Who", "notes": ""},
+			want:    `2 "Fix the gate" type="" owner="Ana" priority="" due=- done=false`,
+		},
+		{
+			name:    "unreadable values",
+			content: "Title,Priority,Due\nFix the gate,urgent,someday\n",
+			want:    `2 "Fix the gate" type="" owner="" priority="urgent" due=- done=false error=due_at`,
+		},
+		{
+			name:    "short rows",
+			content: "Title,Owner,Notes\nFix the gate\n",
+			want:    `2 "Fix the gate" type="" owner="" priority="" due=- done=false`,
+		},
+		{name: "empty", content: "", wantErr: "the CSV file is empty"},
+		{name: "no title column", content: "Owner,Notes\nAna,Hinges\n", wantErr: "no column is mapped to title"},
+		{name: "unknown field", content: "Title\nFix\n", mapping: map[string]string{"colour": "Title"}, wantErr: `unknown field "colour"`},
+		{name: "missing column", content: "Title\nFix\n", mapping: map[string]string{"owner": "Who"}, wantErr: `missing column "Who"`},
+		{name: "bad quoting", content: "Title\n\"Fix the gate\n", wantErr: "invalid CSV"},
+	}
+	for _, tt := range tests {
+		_, _, rows, err := parseCSVTasks(tt.content, tt.mapping)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case summarize(rows) != tt.want:
+			t.Errorf("%s: rows\n%s\nwant\n%s", tt.name, summarize(rows), tt.want)
+		}
+	}
+}
+
+func TestParseICSTodos(t *testing.T) {
+	newTestStore(t)
+	ongoing := categories.Name(CategoryOngoing)
+	calendar := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    string // summarize of the rows
+		wantErr bool
+	}{
+		{
+			name: "full to-do",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Fix the gate\\, and the fe",
+				" nce",
+				"DESCRIPTION:Hinges\\nLatch",
+				"DUE:20250307T103000Z",
+				"PRIORITY:1",
+				"CATEGORIES:Garden,"+ongoing,
+				"RRULE:FREQ=WEEKLY",
+				"BEGIN:VALARM",
+				"DESCRIPTION:Reminder",
+				"END:VALARM",
+				"END:VTODO",
+			),
+			want: `1 "Fix the gate, and the fence" type="` + ongoing + `" owner="" priority="High" due=2025-03-07T10:30:00Z done=false notes="Hinges\nLatch" rrule=FREQ=WEEKLY`,
+		},
+		{
+			name: "dates, priorities and completion",
+			content: calendar(
+				"BEGIN:VTODO", "SUMMARY:Order bins", "DUE;VALUE=DATE:20250307", "PRIORITY:5", "STATUS:COMPLETED", "END:VTODO",
+				"BEGIN:VEVENT", "SUMMARY:Not a to-do", "END:VEVENT",
+				"BEGIN:VTODO", "SUMMARY:Call the plumber", "DUE;TZID=America/New_York:20250307T090000", "PRIORITY:9", "COMPLETED:20250301T100000Z", "END:VTODO",
+				"BEGIN:VTODO", "SUMMARY:Paint", "DUE:soon", "PRIORITY:0", "END:VTODO",
+			),
+			want: `1 "Order bins" type="" owner="" priority="Medium" due=` + time.Date(2025, 3, 7, 23, 59, 59, 0, time.Local).UTC().Format(time.RFC3339) + ` done=true` + "\n" +
+				`2 "Call the plumber" type="" owner="" priority="Low" due=2025-03-07T14:00:00Z done=true` + "\n" +
+				`3 "Paint" type="" owner="" priority="" due=- done=false error=due_at`,
+		},
+		{name: "no to-dos", content: calendar("BEGIN:VEVENT", "SUMMARY:Meeting", "END:VEVENT"), want: ""},
+		{name: "not a calendar", content: "Title\nFix the gate\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		rows, err := parseICSTodos(tt.content)
+		switch {
+		case tt.wantErr:
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case summarize(rows) != tt.want:
+			t.Errorf("%s: rows\n%s\nwant\n%s", tt.name, summarize(rows), tt.want)
+		}
+	}
+}
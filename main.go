@@ -2,236 +2,257 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Task represents a single task
 type Task struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Type        string    `json:"type"`
-	Owner       string    `json:"owner"`
-	Priority    string    `json:"priority"`
-	Completed   bool      `json:"completed"`
-	Notes       string    `json:"notes"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Type        string     `json:"type"`
+	Owner       string     `json:"owner"`
+	Owners      []PersonID `json:"owners"`
+	Priority    string     `json:"priority"`
+	Completed   bool       `json:"completed"`
+	Notes       string     `json:"notes"`
+	CreatedAt   time.Time  `json:"created_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Version     int        `json:"version"`
+
+	// Recurrence is an RRULE such as "FREQ=WEEKLY;BYDAY=WE". Completing a
+	// recurring task creates its next occurrence, numbered Occurrence+1 in
+	// the series that started with task SeriesID.
+	Recurrence     string `json:"recurrence,omitempty"`
+	SeriesID       int    `json:"series_id,omitempty"`
+	Occurrence     int    `json:"occurrence,omitempty"`
+	NextOccurrence int    `json:"next_occurrence,omitempty"` // ID of the task created on completion
+
+	// ParentID makes the task a subtask of another. A parent with
+	// AutoComplete set is completed once its checklist and subtasks are done.
+	ParentID     int             `json:"parent_id,omitempty"`
+	Checklist    []ChecklistItem `json:"checklist,omitempty"`
+	AutoComplete bool            `json:"auto_complete,omitempty"`
+
+	// BlockedBy lists the tasks that must be completed before this one.
+	BlockedBy []int `json:"blocked_by,omitempty"`
+
+	// ResidentID links the task to a resident synced from Zoho CRM.
+	ResidentID string `json:"resident_id,omitempty"`
+
+	// WorkflowStatus is the board column the task is in, and Position its
+	// place in that column, counting from 1 at the top.
+	WorkflowStatus string `json:"workflow_status"`
+	Position       int    `json:"position,omitempty"`
 }
 
-// TaskManager holds all tasks
-type TaskManager struct {
-	Tasks  []Task `json:"tasks"`
-	NextID int    `json:"next_id"`
+// HasOwner reports whether the person is one of the task's owners
+func (t Task) HasOwner(id PersonID) bool {
+	return slices.Contains(t.Owners, id)
 }
 
-var taskManager = TaskManager{
-	Tasks:  []Task{},
-	NextID: 1,
-}
+// taskManager holds all tasks
+var taskManager *TaskManager
 
-// Initialize with predefined tasks
-func initializeTasks() {
-	tasks := []Task{
-		{
-			ID:        1,
-			Title:     "Schedule follow-up meeting - Tomorrow at 7:30 AM",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro & Endri",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Endri to create recurring weekly meeting",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        2,
-			Title:     "Audit current Calendly setup",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro & Endri",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Review all existing schedules, clones, and configurations",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        3,
-			Title:     "Complete resident list cleanup",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Michael & Tariro",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Verify all current vs. former residents in Zoho",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        4,
-			Title:     "Implement SMS capability",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Michael & Technical Team",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Deploy text messaging API integration in Zoho within one week",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        5,
-			Title:     "Establish Calendly change procedures",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Liz, Tariro, Endri",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Define who updates what and when",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        6,
-			Title:     "Fix recurring meeting setup",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Endri",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Ensure Wednesday 7:30 AM meetings auto-schedule properly",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        7,
-			Title:     "Track residency completion dates",
-			Type:      "Ongoing Management Tasks",
-			Owner:     "Liz",
-			Priority:  "Low",
-			Completed: false,
-			Notes:     "Monitor approaching end dates for proper offboarding",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        8,
-			Title:     "Establish clear handoff procedures",
-			Type:      "Communication & Coordination",
-			Owner:     "All Team",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Between Liz and Tariro for scheduling",
-			CreatedAt: time.Now(),
-		},
-		// New tasks from transcript
-		{
-			ID:        9,
-			Title:     "Clarify Liz's role in resident onboarding workflow",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Liz & Colin",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Determine if Liz's info goes in welcome email, separate intro email, or both. Resolve redundancy concerns.",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        10,
-			Title:     "Implement Liz's automated welcome email in workflow",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Endri",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Add Liz's intro email to step 8 after payment confirmation, pending Colin's decision on timing",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        11,
-			Title:     "Train Liz on Zoho CRM functionality",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Scheduled for tomorrow at 7:00 AM - focus on Calendly integration and scheduling features",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        12,
-			Title:     "Fix Ryan's Calendly schedule - Wednesday Peoria training",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Correct Wednesday availability to 7:00 AM - 12:00 PM only. Remove incorrect Monday/Tuesday/Friday availability.",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        13,
-			Title:     "Fix Ryan's Calendly schedule - Friday Doctor Hernandez time",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Correct Friday availability to 1:00 PM - 4:00 PM only. Remove incorrect other day availability.",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        14,
-			Title:     "Update Ryan's time off - Florida trip June 16-18",
-			Type:      "Immediate Tasks (24-48 hours)",
-			Owner:     "Tariro",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Add June 16-18 time off, ensure availability June 19-20. Check June 24 Tuesday availability issue.",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        15,
-			Title:     "Implement Calendly overlap prevention procedures",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Tariro & Liz",
-			Priority:  "High",
-			Completed: false,
-			Notes:     "Create hard stops and verification steps to prevent scheduling conflicts like Greg situation",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        16,
-			Title:     "Document resident onboarding workflow clarifications",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Endri",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Update workflow documentation based on Colin's decisions about Liz's role and email timing",
-			CreatedAt: time.Now(),
-		},
-		{
-			ID:        17,
-			Title:     "Establish Liz as primary Calendly administrator",
-			Type:      "Process Improvement Tasks (1-2 weeks)",
-			Owner:     "Tariro & Liz",
-			Priority:  "Medium",
-			Completed: false,
-			Notes:     "Train Liz to take over Calendly management to prevent future scheduling issues",
-			CreatedAt: time.Now(),
-		},
-	}
+// taskPriorities are the allowed priority levels, highest first
+var taskPriorities = []string{"High", "Medium", "Low"}
 
-	taskManager.Tasks = tasks
-	taskManager.NextID = 18
+// seedTasks fills an empty store from the seed file and reports any
+// entries that were rejected.
+func seedTasks(path string) error {
+	tasks, nextID, rejected, err := loadSeedFile(path)
+	if err != nil {
+		return err
+	}
+	for _, r := range rejected {
+		log.Printf("seed: rejected %s", r)
+	}
+	log.Printf("seed: loaded %d tasks from %s (%d rejected)", len(tasks), path, len(rejected))
+	return taskManager.Seed(tasks, nextID)
 }
+
 func main() {
-	// Initialize tasks
-	initializeTasks()
+	if len(os.Args) > 1 && os.Args[1] == "transcript" {
+		if err := runTranscriptCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImportCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Serve static files (CSS, JS, images)
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	storeKind := flag.String("store", "json", "storage backend: json or sqlite")
+	dataPath := flag.String("data", "data", "JSON store directory or SQLite database file")
+	seedPath := flag.String("seed", "seed.json", "JSON file of tasks loaded when the store is empty (\"\" to start empty)")
+	smtpAddr := flag.String("smtp", "", "host:port of the SMTP server for email notifications (\"\" to only log them)")
+	smtpFrom := flag.String("smtp-from", "tasks@localhost", "sender address of notification emails")
+	smtpUser := flag.String("smtp-user", "", "SMTP username; the password is read from LIZ_SMTP_PASSWORD")
+	baseURL := flag.String("base-url", "http://localhost:8000", "address of the dashboard, for links in emails")
+	flag.Parse()
+
+	store, err := openStore(*storeKind, *dataPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	people, err = NewPeopleRegistry(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	categories, err = NewCategoryRegistry(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	workflow, err = NewWorkflow(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	residents, err = NewResidentRegistry(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load tasks, seeding them on first start
+	taskManager = NewTaskManager(store, people)
+	found, err := taskManager.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !found && *seedPath != "" {
+		if err := seedTasks(*seedPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	history, err = NewHistoryLog(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	taskManager.Subscribe(history.Notify)
+	go history.Run()
+
+	comments, err = NewCommentStore(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	taskManager.Subscribe(removeDeletedThreads)
+
+	transcriptManager, err = NewTranscriptManager(store, taskManager)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	accounts, err = NewAccountStore(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := comments.AssignAuthors(accounts.List()); err != nil {
+		log.Fatal(err)
+	}
+	tokens, err = NewTokenStore(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var mailer Mailer = logMailer{}
+	if *smtpAddr != "" {
+		mailer = SMTPMailer{Addr: *smtpAddr, From: *smtpFrom, Username: *smtpUser, Password: os.Getenv("LIZ_SMTP_PASSWORD")}
+	}
+	notifier, err = NewNotifier(store, mailer, *baseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	taskManager.Subscribe(notifier.Notify)
+	go notifier.Run()
 
-	// Routes
-	http.HandleFunc("/", homeHandler)
-	http.HandleFunc("/api/tasks", tasksHandler)
-	http.HandleFunc("/api/tasks/", taskHandler)
+	webhooks, err = NewWebhookRegistry(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	taskManager.Subscribe(webhooks.Notify)
+	webhooks.Resume()
+	go webhooks.Run()
+
+	calendly, err = NewCalendlyIntegration(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go residents.RunSync()
+
+	if accounts.Empty() {
+		log.Print("no accounts yet: open http://localhost:8000/setup to create the first one")
+	}
 
 	fmt.Println("🚀 AMSKU Task Management Server starting on http://localhost:8000")
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	log.Fatal(http.ListenAndServe(":8000", routes()))
+}
+
+// routes returns the handler for every page and API endpoint.
+func routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Serve static files (CSS, JS, images)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+
+	// Routes. Everything under /api except signing in and the Calendly
+	// receiver, which checks Calendly's signature, needs a session or an
+	// API token.
+	mux.HandleFunc("/", homeHandler)
+	mux.HandleFunc("/login", loginHandler)
+	mux.HandleFunc("/setup", setupHandler)
+	mux.HandleFunc("/api/session", sessionHandler)
+	mux.HandleFunc("/api/accounts", requireLogin(accountsHandler))
+	mux.HandleFunc("/api/accounts/", requireLogin(accountsHandler))
+	mux.HandleFunc("/api/tokens", requireLogin(tokensHandler))
+	mux.HandleFunc("/api/tokens/", requireLogin(tokensHandler))
+	mux.HandleFunc("/api/tasks", requireLogin(tasksHandler))
+	mux.HandleFunc("/api/tasks/", requireLogin(taskHandler))
+	mux.HandleFunc("/api/tasks/export", requireLogin(exportHandler))
+	mux.HandleFunc("/api/history", requireLogin(historyHandler))
+	mux.HandleFunc("/api/calendar.ics", calendarFeed(calendarHandler))
+	mux.HandleFunc("/api/import", requireLogin(importHandler))
+	mux.HandleFunc("/api/people", requireLogin(peopleHandler))
+	mux.HandleFunc("/api/people/", requireLogin(peopleHandler))
+	mux.HandleFunc("/api/categories", requireLogin(categoriesHandler))
+	mux.HandleFunc("/api/categories/", requireLogin(categoriesHandler))
+	mux.HandleFunc("/api/workflow", requireLogin(workflowHandler))
+	mux.HandleFunc("/api/transcripts", requireLogin(transcriptsHandler))
+	mux.HandleFunc("/api/notifications", requireLogin(notificationsHandler))
+	mux.HandleFunc("/api/notifications/", requireLogin(notificationsHandler))
+	mux.HandleFunc("/api/webhooks", requireLogin(webhooksHandler))
+	mux.HandleFunc("/api/webhooks/", requireLogin(webhooksHandler))
+	mux.HandleFunc("/api/integrations/calendly", calendlyHandler)
+	mux.HandleFunc("/api/integrations/calendly/config", requireLogin(calendlyConfigHandler))
+	mux.HandleFunc("/api/integrations/zoho/config", requireLogin(zohoConfigHandler))
+	mux.HandleFunc("/api/integrations/zoho/sync", requireLogin(zohoSyncHandler))
+	mux.HandleFunc("/api/residents", requireLogin(residentsHandler))
+	mux.HandleFunc("/api/residents/", requireLogin(residentsHandler))
+	mux.HandleFunc("/api/transcripts/", requireLogin(transcriptsHandler))
+	return mux
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := currentSession(r); !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	
+
 	// Write the HTML directly to avoid template parsing issues
 	html := `<!DOCTYPE html>
 <html lang="en">
@@ -280,6 +301,15 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             opacity: 0.9;
         }
 
+        .header .user-bar {
+            font-size: 0.9rem;
+            margin-top: 10px;
+        }
+
+        .user-bar a {
+            color: white;
+        }
+
         .controls {
             padding: 20px 30px;
             background: #f8fafc;
@@ -435,6 +465,100 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             position: relative;
         }
 
+        .board {
+            display: flex;
+            gap: 15px;
+            overflow-x: auto;
+            padding-bottom: 10px;
+        }
+
+        .board-column {
+            flex: 1 0 260px;
+            background: #f1f5f9;
+            border-radius: 12px;
+            padding: 12px;
+            min-height: 300px;
+        }
+
+        .board-column.drag-over {
+            outline: 2px dashed #667eea;
+        }
+
+        .board-column-title {
+            font-weight: 700;
+            color: #1e293b;
+            margin-bottom: 10px;
+        }
+
+        .board-card {
+            background: white;
+            border: 1px solid #e5e7eb;
+            border-left: 4px solid #667eea;
+            border-radius: 8px;
+            padding: 10px 12px;
+            margin-bottom: 8px;
+        }
+
+        .board-card[draggable="true"] {
+            cursor: grab;
+        }
+
+        .board-card .task-meta {
+            margin: 6px 0 0;
+        }
+
+        .calendar-nav {
+            display: flex;
+            gap: 10px;
+            align-items: center;
+            margin-bottom: 10px;
+        }
+
+        .calendar-grid {
+            display: grid;
+            grid-template-columns: repeat(7, 1fr);
+            gap: 4px;
+        }
+
+        .calendar-weekday {
+            font-weight: 700;
+            color: #6b7280;
+            text-align: center;
+            padding: 4px;
+        }
+
+        .calendar-day {
+            background: white;
+            border: 1px solid #e5e7eb;
+            border-radius: 6px;
+            min-height: 90px;
+            padding: 4px 6px;
+            font-size: 0.85rem;
+        }
+
+        .calendar-day.other-month { background: #f8fafc; color: #9ca3af; }
+        .calendar-day.today { border-color: #667eea; }
+
+        .calendar-task {
+            border-left: 3px solid #667eea;
+            background: #f1f5f9;
+            border-radius: 4px;
+            padding: 2px 4px;
+            margin-top: 3px;
+            cursor: pointer;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
+
+        .calendar-task.completed { text-decoration: line-through; opacity: 0.6; }
+
+        .calendar-feed {
+            color: #6b7280;
+            font-size: 0.85rem;
+            margin-top: 10px;
+        }
+
         .task-card:hover {
             box-shadow: 0 8px 25px rgba(0,0,0,0.1);
             transform: translateY(-2px);
@@ -470,8 +594,12 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
         .badge-high { background: #fef2f2; color: #dc2626; }
         .badge-medium { background: #fffbeb; color: #d97706; }
         .badge-low { background: #f0f9ff; color: #0284c7; }
+        .badge-overdue { background: #dc2626; color: white; }
+        .badge-due-soon { background: #f59e0b; color: white; }
+        .badge-repeats { background: #eef2ff; color: #4338ca; }
+        .badge-blocked { background: #fef2f2; color: #991b1b; }
 
-        .task-owner {
+        .task-owner, .task-resident {
             color: #6b7280;
             font-size: 0.9rem;
             margin-bottom: 10px;
@@ -484,10 +612,107 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             font-size: 0.9rem;
             color: #4b5563;
             line-height: 1.4;
+            white-space: pre-line;
             margin-bottom: 15px;
             border-left: 3px solid #e5e7eb;
         }
 
+        .task-comments {
+            margin-bottom: 15px;
+        }
+
+        .task-progress {
+            height: 6px;
+            background: #e5e7eb;
+            border-radius: 3px;
+            margin-bottom: 10px;
+            overflow: hidden;
+        }
+
+        .task-progress div {
+            height: 100%;
+            background: #10b981;
+        }
+
+        .checklist {
+            list-style: none;
+            margin-bottom: 10px;
+            font-size: 0.9rem;
+            color: #374151;
+        }
+
+        .checklist li {
+            display: flex;
+            align-items: center;
+            gap: 6px;
+            margin-bottom: 4px;
+        }
+
+        .checklist li.done span {
+            text-decoration: line-through;
+            color: #9ca3af;
+        }
+
+        .checklist a {
+            color: #9ca3af;
+            cursor: pointer;
+            font-size: 0.75rem;
+        }
+
+        .task-subtasks {
+            font-size: 0.85rem;
+            color: #6b7280;
+            margin-bottom: 10px;
+        }
+
+        .comment-toggle {
+            background: none;
+            border: none;
+            color: #4f46e5;
+            font-weight: 600;
+            cursor: pointer;
+            padding: 0;
+        }
+
+        .comment-thread {
+            margin-top: 10px;
+            border-left: 3px solid #c7d2fe;
+            padding-left: 10px;
+        }
+
+        .comment {
+            font-size: 0.85rem;
+            color: #374151;
+            margin-bottom: 8px;
+        }
+
+        .comment-meta {
+            color: #9ca3af;
+            font-size: 0.75rem;
+        }
+
+        .comment-meta a {
+            color: #6b7280;
+            margin-left: 6px;
+            cursor: pointer;
+        }
+
+        .mention {
+            background: #eef2ff;
+            color: #4338ca;
+            border-radius: 4px;
+            padding: 0 3px;
+        }
+
+        .comment-form {
+            display: flex;
+            gap: 6px;
+        }
+
+        .comment-form input {
+            flex: 1;
+        }
+
         .task-actions {
             display: flex;
             gap: 10px;
@@ -569,6 +794,32 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             min-height: 100px;
         }
 
+        .history-panel {
+            margin-top: 20px;
+            border-top: 1px solid #e5e7eb;
+            padding-top: 15px;
+            max-height: 220px;
+            overflow-y: auto;
+        }
+
+        .history-panel h3 {
+            font-size: 1rem;
+            color: #374151;
+            margin-bottom: 10px;
+        }
+
+        .history-entry {
+            font-size: 0.85rem;
+            color: #4b5563;
+            padding: 6px 0;
+            border-bottom: 1px dashed #e5e7eb;
+        }
+
+        .history-entry .history-when {
+            color: #9ca3af;
+            font-size: 0.75rem;
+        }
+
         .close {
             position: absolute;
             top: 15px;
@@ -618,6 +869,7 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
         <div class="header">
             <h1>🎯 AMSKU Task Management</h1>
             <p>Track progress and coordinate team tasks efficiently</p>
+            <p class="user-bar">Signed in as <strong id="userName"></strong> · <span id="notificationsLink"><a href="#" onclick="openNotificationsModal(); return false;">Notifications</a> · </span><a href="#" onclick="logout(); return false;">Sign out</a></p>
         </div>
 
         <div class="controls">
@@ -625,10 +877,6 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                 <label for="typeFilter">Filter by Type:</label>
                 <select id="typeFilter" onchange="filterTasks()">
                     <option value="">All Types</option>
-                    <option value="Immediate Tasks (24-48 hours)">Immediate Tasks (24-48 hours)</option>
-                    <option value="Process Improvement Tasks (1-2 weeks)">Process Improvement Tasks (1-2 weeks)</option>
-                    <option value="Ongoing Management Tasks">Ongoing Management Tasks</option>
-                    <option value="Communication & Coordination">Communication & Coordination</option>
                 </select>
             </div>
 
@@ -638,6 +886,9 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                     <option value="">All Tasks</option>
                     <option value="pending">Pending</option>
                     <option value="completed">Completed</option>
+                    <option value="overdue">Overdue</option>
+                    <option value="due_soon">Due Soon</option>
+                    <option value="blocked">Blocked</option>
                 </select>
             </div>
 
@@ -648,7 +899,35 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                 </select>
             </div>
 
-            <button class="btn btn-primary" onclick="openAddTaskModal()">+ Add New Task</button>
+            <div class="filter-group">
+                <label for="viewMode">View:</label>
+                <select id="viewMode" onchange="setView(this.value)">
+                    <option value="list">List</option>
+                    <option value="board">Board</option>
+                    <option value="calendar">Calendar</option>
+                </select>
+            </div>
+
+            <div class="filter-group">
+                <label for="scopeFilter">Show:</label>
+                <select id="scopeFilter" onchange="setScope(this.value)">
+                    <option value="">All Tasks</option>
+                    <option value="mine">My Tasks</option>
+                </select>
+            </div>
+
+            <div class="filter-group">
+                <label for="exportFormat">Export:</label>
+                <select id="exportFormat" onchange="exportTasks(this.value); this.value = ''">
+                    <option value="">Choose format…</option>
+                    <option value="md">Markdown</option>
+                    <option value="html">Printable report</option>
+                    <option value="csv">CSV</option>
+                    <option value="json">JSON</option>
+                </select>
+            </div>
+
+            <button class="btn btn-primary" id="addTaskButton" onclick="openAddTaskModal()">+ Add New Task</button>
         </div>
 
         <div class="stats">
@@ -670,6 +949,23 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
 
+        <div class="board" id="boardContainer" style="display: none;"></div>
+
+        <div class="calendar" id="calendarContainer" style="display: none;">
+            <div class="calendar-nav">
+                <button class="btn btn-secondary" onclick="shiftCalendar(-1)">‹</button>
+                <button class="btn btn-secondary" onclick="calendarDate = new Date(); renderTasks()">Today</button>
+                <button class="btn btn-secondary" onclick="shiftCalendar(1)">›</button>
+                <strong id="calendarTitle"></strong>
+                <select id="calendarSpan" onchange="renderTasks()">
+                    <option value="month">Month</option>
+                    <option value="week">Week</option>
+                </select>
+            </div>
+            <div class="calendar-grid" id="calendarGrid"></div>
+            <p class="calendar-feed">Subscribe from your calendar app with <code>/api/calendar.ics?token=…</code> using a read-only API token. Add <code>&amp;owner=me</code> for just your tasks, or <code>&amp;events=true</code> if your app ignores to-dos.</p>
+        </div>
+
         <div class="task-types" id="taskContainer">
             <!-- Tasks will be loaded here -->
         </div>
@@ -684,6 +980,7 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             </div>
             <form id="taskForm">
                 <input type="hidden" id="taskId" value="">
+                <input type="hidden" id="taskVersion" value="">
                 <div class="form-group">
                     <label for="taskTitle">Task Title</label>
                     <input type="text" id="taskTitle" required>
@@ -692,15 +989,12 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                     <label for="taskType">Task Type</label>
                     <select id="taskType" required>
                         <option value="">Select Type</option>
-                        <option value="Immediate Tasks (24-48 hours)">Immediate Tasks (24-48 hours)</option>
-                        <option value="Process Improvement Tasks (1-2 weeks)">Process Improvement Tasks (1-2 weeks)</option>
-                        <option value="Ongoing Management Tasks">Ongoing Management Tasks</option>
-                        <option value="Communication & Coordination">Communication & Coordination</option>
                     </select>
                 </div>
                 <div class="form-group">
                     <label for="taskOwner">Owner</label>
-                    <input type="text" id="taskOwner" required>
+                    <input type="text" id="taskOwner" list="peopleList" placeholder="e.g. Tariro & Endri" required>
+                    <datalist id="peopleList"></datalist>
                 </div>
                 <div class="form-group">
                     <label for="taskPriority">Priority</label>
@@ -711,6 +1005,29 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                         <option value="Low">Low</option>
                     </select>
                 </div>
+                <div class="form-group">
+                    <label for="taskDue">Due Date</label>
+                    <input type="date" id="taskDue">
+                </div>
+                <div class="form-group">
+                    <label for="taskRecurrence">Repeats</label>
+                    <input type="text" id="taskRecurrence" list="recurrencePresets" placeholder="Does not repeat, or e.g. FREQ=WEEKLY;BYDAY=WE">
+                    <datalist id="recurrencePresets">
+                        <option value="FREQ=DAILY">Every day</option>
+                        <option value="FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR">Every weekday</option>
+                        <option value="FREQ=WEEKLY">Every week</option>
+                        <option value="FREQ=WEEKLY;INTERVAL=2">Every 2 weeks</option>
+                        <option value="FREQ=MONTHLY">Every month</option>
+                    </datalist>
+                </div>
+                <div class="form-group">
+                    <label for="taskBlockedBy">Blocked By</label>
+                    <select id="taskBlockedBy" multiple size="4"></select>
+                </div>
+                <div class="form-group">
+                    <label for="taskResident">Resident</label>
+                    <select id="taskResident"></select>
+                </div>
                 <div class="form-group">
                     <label for="taskNotes">Notes</label>
                     <textarea id="taskNotes" placeholder="Add any notes or progress updates..."></textarea>
@@ -719,24 +1036,93 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                     <label>
                         <input type="checkbox" id="taskCompleted"> Mark as completed
                     </label>
+                    <label>
+                        <input type="checkbox" id="taskAutoComplete"> Complete automatically when every checklist item and subtask is done
+                    </label>
                 </div>
+                <input type="hidden" id="taskParent" value="">
                 <button type="submit" class="btn btn-primary">Save Task</button>
             </form>
+            <div id="taskHistory" class="history-panel" style="display: none;"></div>
+        </div>
+    </div>
+
+    <!-- Notification Settings Modal -->
+    <div id="notificationsModal" class="modal">
+        <div class="modal-content">
+            <span class="close" onclick="closeNotificationsModal()">&times;</span>
+            <div class="modal-header">
+                <h2 class="modal-title">Email Notifications</h2>
+            </div>
+            <form id="notificationsForm">
+                <div class="form-group">
+                    <label for="notifyEmail">Send to</label>
+                    <input type="email" id="notifyEmail" placeholder="Your address in the People list">
+                </div>
+                <div class="form-group">
+                    <label><input type="checkbox" id="notifyAssigned"> A task is added for me or assigned to me</label>
+                    <label><input type="checkbox" id="notifyDueSoon"> One of my tasks is due within a day</label>
+                    <label><input type="checkbox" id="notifyOverdue"> One of my tasks is overdue</label>
+                    <label><input type="checkbox" id="notifyCompleted"> Someone else completes one of my tasks</label>
+                </div>
+                <div class="form-group">
+                    <label><input type="checkbox" id="notifyDigest"> Send one digest a day instead of separate emails</label>
+                    <label for="notifyDigestHour">Digest time</label>
+                    <select id="notifyDigestHour"></select>
+                </div>
+                <button type="submit" class="btn btn-primary">Save</button>
+                <button type="button" class="btn" onclick="sendTestEmail()">Send test email</button>
+            </form>
         </div>
     </div>
 
     <script>
         let tasks = [];
-
-        // Load tasks on page load
-        document.addEventListener('DOMContentLoaded', function() {
+        let people = [];
+        let categories = [];
+        let workflowStatuses = [];
+        let residents = [];
+        let calendarDate = new Date();
+        let session = null;
+        const openThreads = new Set();
+
+        // Load the signed-in account, then tasks, on page load
+        document.addEventListener('DOMContentLoaded', async function() {
+            document.getElementById('scopeFilter').value = localStorage.getItem('scope') || '';
+            document.getElementById('viewMode').value = localStorage.getItem('view') || 'list';
+            const response = await apiFetch('/api/session');
+            if (!response.ok) return;
+            session = await response.json();
+            document.getElementById('userName').textContent = session.name + ' (' + session.role + ')';
+            document.getElementById('notificationsLink').style.display = session.person_id ? '' : 'none';
+            if (!can('create_task')) {
+                document.getElementById('addTaskButton').style.display = 'none';
+            }
             loadTasks();
         });
 
+        // can reports whether the signed-in account has a permission
+        function can(permission) {
+            return session !== null && session.permissions.includes(permission);
+        }
+
+        // canWorkOn mirrors the server's rule: admins may change any task,
+        // members only the tasks they own
+        function canWorkOn(task) {
+            return can('edit_task') || (can('edit_own_task') && (task.owners || []).includes(session.person_id));
+        }
+
         async function loadTasks() {
             try {
-                const response = await fetch('/api/tasks');
-                tasks = await response.json();
+                const [taskResponse, peopleResponse, categoryResponse, workflowResponse, residentResponse] = await Promise.all([
+                    apiFetch('/api/tasks'), apiFetch('/api/people'), apiFetch('/api/categories'), apiFetch('/api/workflow'), apiFetch('/api/residents'),
+                ]);
+                tasks = await taskResponse.json();
+                people = await peopleResponse.json();
+                categories = await categoryResponse.json();
+                workflowStatuses = await workflowResponse.json();
+                residents = await residentResponse.json();
+                populateCategories();
                 renderTasks();
                 updateStats();
                 populateOwnerFilter();
@@ -747,33 +1133,39 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 
         function renderTasks() {
             const container = document.getElementById('taskContainer');
-            const typeFilter = document.getElementById('typeFilter').value;
-            const statusFilter = document.getElementById('statusFilter').value;
-            const ownerFilter = document.getElementById('ownerFilter').value;
-
-            // Filter tasks
-            let filteredTasks = tasks.filter(task => {
-                if (typeFilter && task.type !== typeFilter) return false;
-                if (statusFilter === 'completed' && !task.completed) return false;
-                if (statusFilter === 'pending' && task.completed) return false;
-                if (ownerFilter && task.owner !== ownerFilter) return false;
-                return true;
-            });
+            const view = document.getElementById('viewMode').value;
+            container.style.display = view === 'list' ? '' : 'none';
+            document.getElementById('boardContainer').style.display = view === 'board' ? '' : 'none';
+            document.getElementById('calendarContainer').style.display = view === 'calendar' ? '' : 'none';
+            if (view === 'board') {
+                renderBoard(visibleTasks());
+                return;
+            }
+            if (view === 'calendar') {
+                renderCalendar(visibleTasks());
+                return;
+            }
 
             // Group tasks by type
             const tasksByType = {};
-            filteredTasks.forEach(task => {
+            visibleTasks().forEach(task => {
                 if (!tasksByType[task.type]) {
                     tasksByType[task.type] = [];
                 }
                 tasksByType[task.type].push(task);
             });
 
+            // Show categories in their configured order, then any others
+            const order = categories.map(c => c.name);
+            const types = Object.keys(tasksByType).sort((a, b) =>
+                (order.indexOf(a) + 1 || order.length + 1) - (order.indexOf(b) + 1 || order.length + 1));
+
             let html = '';
-            Object.keys(tasksByType).forEach(type => {
+            types.forEach(type => {
+                const category = categories.find(c => c.name === type);
                 html += '<div class="task-type">';
-                html += '<div class="task-type-header">';
-                html += '<div class="task-type-title">' + type + '</div>';
+                html += '<div class="task-type-header"' + (category ? ' style="border-left-color: ' + category.color + '"' : '') + '>';
+                html += '<div class="task-type-title">' + escapeHtml(type) + '</div>';
                 html += '</div>';
                 html += '<div class="task-grid">';
                 
@@ -782,24 +1174,51 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                     if (task.completed) {
                         html += '<div class="completion-badge">✓ Completed</div>';
                     }
-                    html += '<div class="task-title">' + task.title + '</div>';
+                    html += '<div class="task-title">' + escapeHtml(task.title) + '</div>';
                     html += '<div class="task-meta">';
                     html += '<span class="badge badge-' + task.priority.toLowerCase() + '">' + task.priority + '</span>';
+                    if (task.overdue) {
+                        html += '<span class="badge badge-overdue">Overdue</span>';
+                    } else if (task.due_soon) {
+                        html += '<span class="badge badge-due-soon">Due Soon</span>';
+                    }
+                    if (task.repeats) {
+                        html += '<span class="badge badge-repeats">🔁 ' + escapeHtml(task.repeats) + '</span>';
+                    }
+                    if (task.blocked) {
+                        html += '<span class="badge badge-blocked">⛔ Blocked</span>';
+                    }
                     html += '</div>';
-                    html += '<div class="task-owner">👤 ' + task.owner + '</div>';
+                    html += '<div class="task-owner">👤 ' + escapeHtml(task.owner) + '</div>';
+                    if (task.resident_name) {
+                        html += '<div class="task-resident">🏠 ' + escapeHtml(task.resident_name) + '</div>';
+                    }
                     if (task.notes) {
-                        html += '<div class="task-notes">' + task.notes + '</div>';
+                        html += '<div class="task-notes">' + escapeHtml(task.notes) + '</div>';
                     }
+                    html += renderSteps(task);
+                    html += '<div class="task-comments">';
+                    html += '<button class="comment-toggle" onclick="toggleComments(' + task.id + ')">💬 ' + task.comment_count + (task.comment_count === 1 ? ' comment' : ' comments') + '</button>';
+                    html += '<div class="comment-thread" id="comments-' + task.id + '" style="display: none;"></div>';
+                    html += '</div>';
                     html += '<div class="task-actions">';
-                    html += '<div class="task-date">Created: ' + new Date(task.created_at).toLocaleDateString() + '</div>';
+                    html += '<div class="task-date">Created: ' + new Date(task.created_at).toLocaleDateString();
+                    if (task.due_at) {
+                        html += '<br>Due: ' + new Date(task.due_at).toLocaleDateString();
+                    }
+                    html += '</div>';
                     html += '<div>';
-                    if (!task.completed) {
-                        html += '<button class="btn btn-success" onclick="toggleTaskCompletion(' + task.id + ')">Mark Complete</button>';
-                    } else {
-                        html += '<button class="btn btn-secondary" onclick="toggleTaskCompletion(' + task.id + ')">Mark Pending</button>';
+                    if (canWorkOn(task)) {
+                        if (!task.completed) {
+                            html += '<button class="btn btn-success" onclick="toggleTaskCompletion(' + task.id + ')">Mark Complete</button>';
+                        } else {
+                            html += '<button class="btn btn-secondary" onclick="toggleTaskCompletion(' + task.id + ')">Mark Pending</button>';
+                        }
+                        html += '<button class="btn btn-secondary" onclick="editTask(' + task.id + ')">Edit</button>';
+                    }
+                    if (can('delete_task')) {
+                        html += '<button class="btn btn-danger" onclick="deleteTask(' + task.id + ')">Delete</button>';
                     }
-                    html += '<button class="btn btn-secondary" onclick="editTask(' + task.id + ')">Edit</button>';
-                    html += '<button class="btn btn-danger" onclick="deleteTask(' + task.id + ')">Delete</button>';
                     html += '</div>';
                     html += '</div>';
                     html += '</div>';
@@ -810,6 +1229,191 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             });
 
             container.innerHTML = html;
+            openThreads.forEach(taskId => loadComments(taskId));
+        }
+
+        // visibleTasks applies the filters to the task list
+        function visibleTasks() {
+            const typeFilter = document.getElementById('typeFilter').value;
+            const statusFilter = document.getElementById('statusFilter').value;
+            const ownerFilter = document.getElementById('ownerFilter').value;
+            const mineOnly = document.getElementById('scopeFilter').value === 'mine';
+
+            return tasks.filter(task => {
+                if (mineOnly && !(task.owners || []).includes(session.person_id)) return false;
+                if (typeFilter && task.type !== typeFilter) return false;
+                if (statusFilter === 'completed' && !task.completed) return false;
+                if (statusFilter === 'pending' && task.completed) return false;
+                if (statusFilter === 'overdue' && !task.overdue) return false;
+                if (statusFilter === 'due_soon' && !task.due_soon) return false;
+                if (statusFilter === 'blocked' && !task.blocked) return false;
+                if (ownerFilter && !(task.owners || []).includes(ownerFilter)) return false;
+                return true;
+            });
+        }
+
+        // exportTasks opens the tasks the filters show in an export format.
+        function exportTasks(format) {
+            if (!format) return;
+            const params = new URLSearchParams({ format: format });
+            const typeFilter = document.getElementById('typeFilter').value;
+            const statusFilter = document.getElementById('statusFilter').value;
+            const ownerFilter = document.getElementById('ownerFilter').value;
+            if (typeFilter) params.set('type', typeFilter);
+            if (statusFilter) params.set('status', statusFilter);
+            if (document.getElementById('scopeFilter').value === 'mine') {
+                if (ownerFilter && ownerFilter !== session.person_id) {
+                    alert('No tasks match the current filters.');
+                    return;
+                }
+                params.set('owner', 'me');
+            } else if (ownerFilter) {
+                params.set('owner', ownerFilter);
+            }
+            if (format === 'csv' || format === 'json') params.set('download', 'true');
+            window.open('/api/tasks/export?' + params.toString(), '_blank');
+        }
+
+        // renderBoard shows tasks as cards in their workflow columns. Cards
+        // the account may work on can be dragged to another column or place.
+        function renderBoard(visible) {
+            let html = '';
+            workflowStatuses.forEach(status => {
+                const cards = visible.filter(t => t.workflow_status === status.id).sort((a, b) => (a.position || 0) - (b.position || 0));
+                html += '<div class="board-column" data-status="' + escapeHtml(status.id) + '" ondragover="dragOverColumn(event)" ondragleave="this.classList.remove(\'drag-over\')" ondrop="dropOnColumn(event)">';
+                html += '<div class="board-column-title">' + (status.done ? '✓ ' : '') + escapeHtml(status.name) + ' (' + cards.length + ')</div>';
+                cards.forEach(task => {
+                    const category = categories.find(c => c.name === task.type);
+                    html += '<div class="board-card" data-id="' + task.id + '"' + (canWorkOn(task) ? ' draggable="true" ondragstart="dragTask(event, ' + task.id + ')"' : '');
+                    html += (category ? ' style="border-left-color: ' + category.color + '"' : '') + '>';
+                    html += '<div class="task-title">' + escapeHtml(task.title) + '</div>';
+                    html += '<div class="task-owner">👤 ' + escapeHtml(task.owner) + '</div>';
+                    html += '<div class="task-meta">';
+                    html += '<span class="badge badge-' + task.priority.toLowerCase() + '">' + task.priority + '</span>';
+                    if (task.overdue) {
+                        html += '<span class="badge badge-overdue">Overdue</span>';
+                    } else if (task.due_soon) {
+                        html += '<span class="badge badge-due-soon">Due Soon</span>';
+                    }
+                    if (task.blocked) {
+                        html += '<span class="badge badge-blocked">⛔ Blocked</span>';
+                    }
+                    html += '</div>';
+                    html += '</div>';
+                });
+                html += '</div>';
+            });
+            document.getElementById('boardContainer').innerHTML = html;
+        }
+
+        // renderCalendar shows tasks on their due dates, a month or a week
+        // at a time, starting on Monday
+        function renderCalendar(visible) {
+            const span = document.getElementById('calendarSpan').value;
+            const first = span === 'month'
+                ? new Date(calendarDate.getFullYear(), calendarDate.getMonth(), 1)
+                : new Date(calendarDate.getFullYear(), calendarDate.getMonth(), calendarDate.getDate());
+            const start = new Date(first);
+            start.setDate(first.getDate() - (first.getDay() + 6) % 7);
+            const days = span === 'month' ? 42 : 7;
+
+            const title = span === 'month'
+                ? first.toLocaleDateString(undefined, { month: 'long', year: 'numeric' })
+                : 'Week of ' + start.toLocaleDateString();
+            document.getElementById('calendarTitle').textContent = title;
+
+            let html = '';
+            ['Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat', 'Sun'].forEach(d => {
+                html += '<div class="calendar-weekday">' + d + '</div>';
+            });
+            const today = toDateInput(new Date());
+            for (let i = 0; i < days; i++) {
+                const day = new Date(start.getFullYear(), start.getMonth(), start.getDate() + i);
+                const key = toDateInput(day);
+                let classes = 'calendar-day';
+                if (span === 'month' && day.getMonth() !== first.getMonth()) classes += ' other-month';
+                if (key === today) classes += ' today';
+                html += '<div class="' + classes + '"><div>' + day.getDate() + '</div>';
+                visible.filter(t => t.due_at && toDateInput(t.due_at) === key).forEach(task => {
+                    const category = categories.find(c => c.name === task.type);
+                    html += '<div class="calendar-task' + (task.completed ? ' completed' : '') + '" title="' + escapeHtml(task.title) + '"';
+                    html += (category ? ' style="border-left-color: ' + category.color + '"' : '');
+                    html += (canWorkOn(task) ? ' onclick="editTask(' + task.id + ')"' : '') + '>';
+                    html += (task.overdue ? '⚠️ ' : '') + escapeHtml(task.title) + '</div>';
+                });
+                html += '</div>';
+            }
+            document.getElementById('calendarGrid').innerHTML = html;
+        }
+
+        function shiftCalendar(direction) {
+            if (document.getElementById('calendarSpan').value === 'month') {
+                calendarDate = new Date(calendarDate.getFullYear(), calendarDate.getMonth() + direction, 1);
+            } else {
+                calendarDate = new Date(calendarDate.getFullYear(), calendarDate.getMonth(), calendarDate.getDate() + 7 * direction);
+            }
+            renderTasks();
+        }
+
+        function dragTask(event, taskId) {
+            event.dataTransfer.setData('text/plain', String(taskId));
+            event.dataTransfer.effectAllowed = 'move';
+        }
+
+        function dragOverColumn(event) {
+            event.preventDefault();
+            event.currentTarget.classList.add('drag-over');
+        }
+
+        // dropOnColumn moves the dragged task above the first card whose
+        // middle is below the pointer
+        function dropOnColumn(event) {
+            event.preventDefault();
+            const column = event.currentTarget;
+            column.classList.remove('drag-over');
+            const taskId = Number(event.dataTransfer.getData('text/plain'));
+            if (!taskId) return;
+            const others = Array.from(column.querySelectorAll('.board-card')).filter(card => Number(card.dataset.id) !== taskId);
+            let position = others.findIndex(card => {
+                const box = card.getBoundingClientRect();
+                return event.clientY < box.top + box.height / 2;
+            });
+            if (position < 0) position = others.length;
+            // Cards hidden by filters still count towards positions
+            const visibleIds = others.map(card => Number(card.dataset.id));
+            const columnTasks = tasks.filter(t => t.workflow_status === column.dataset.status && t.id !== taskId)
+                .sort((a, b) => (a.position || 0) - (b.position || 0));
+            if (position < visibleIds.length) {
+                position = columnTasks.findIndex(t => t.id === visibleIds[position]);
+            } else {
+                position = columnTasks.length;
+            }
+            moveTask(taskId, column.dataset.status, position, false);
+        }
+
+        async function moveTask(taskId, status, position, force) {
+            const task = tasks.find(t => t.id === taskId);
+            try {
+                const response = await apiFetch('/api/tasks/' + taskId + '/move' + (force ? '?force=true' : ''), {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ status: status, position: position, version: task.version }),
+                });
+                if (response.ok) {
+                    loadTasks();
+                } else if (await isBlockedError(response)) {
+                    if (confirmCompleteBlocked(task.blocked_by || [])) {
+                        moveTask(taskId, status, position, true);
+                    }
+                } else if (response.status === 409) {
+                    alert('Someone else changed this task. The board has been refreshed.');
+                    loadTasks();
+                } else {
+                    await showApiError(response);
+                }
+            } catch (error) {
+                console.error('Error moving task:', error);
+            }
         }
 
         function updateStats() {
@@ -826,65 +1430,517 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 
         function populateOwnerFilter() {
             const ownerFilter = document.getElementById('ownerFilter');
-            const owners = [...new Set(tasks.map(t => t.owner))].sort();
-            
+            const selected = ownerFilter.value;
+
+            // Only list people who are assigned to at least one task
+            const assigned = new Set(tasks.flatMap(t => t.owners || []));
             ownerFilter.innerHTML = '<option value="">All Owners</option>';
-            owners.forEach(owner => {
-                ownerFilter.innerHTML += '<option value="' + owner + '">' + owner + '</option>';
+            people.filter(p => assigned.has(p.id)).forEach(person => {
+                ownerFilter.innerHTML += '<option value="' + escapeHtml(person.id) + '">' + escapeHtml(person.name) + '</option>';
             });
+            ownerFilter.value = selected;
+
+            document.getElementById('peopleList').innerHTML = people.map(p => '<option value="' + escapeHtml(p.name) + '">').join('');
+        }
+
+        // populateCategories fills the type filter with every category and
+        // the task form with those new tasks can be given
+        function populateCategories() {
+            const typeFilter = document.getElementById('typeFilter');
+            const selected = typeFilter.value;
+            typeFilter.innerHTML = '<option value="">All Types</option>' + categories.map(c =>
+                '<option value="' + escapeHtml(c.name) + '">' + escapeHtml(c.name) + (c.archived ? ' (archived)' : '') + '</option>').join('');
+            typeFilter.value = selected;
+            setTypeOptions(null);
+        }
+
+        // setTypeOptions lists the active categories in the task form, plus
+        // the archived one an existing task may still be in
+        function setTypeOptions(current) {
+            document.getElementById('taskType').innerHTML = '<option value="">Select Type</option>' +
+                categories.filter(c => !c.archived || c.name === current).map(c =>
+                    '<option value="' + escapeHtml(c.name) + '">' + escapeHtml(c.name) + '</option>').join('');
         }
 
         function filterTasks() {
             renderTasks();
         }
 
-        async function toggleTaskCompletion(taskId) {
+        async function toggleTaskCompletion(taskId, force) {
             try {
-                const response = await fetch('/api/tasks/' + taskId + '/toggle', {
+                const response = await apiFetch('/api/tasks/' + taskId + '/toggle' + (force ? '?force=true' : ''), {
                     method: 'POST',
                 });
                 if (response.ok) {
                     loadTasks();
+                } else if (await isBlockedError(response)) {
+                    const task = tasks.find(t => t.id === taskId);
+                    if (confirmCompleteBlocked(task ? task.blocked_by || [] : [])) {
+                        toggleTaskCompletion(taskId, true);
+                    }
+                } else {
+                    await showApiError(response);
                 }
             } catch (error) {
                 console.error('Error toggling task completion:', error);
             }
         }
 
+        // isBlockedError reports whether a response refused to complete a
+        // task because tasks blocking it are still open
+        async function isBlockedError(response) {
+            if (response.status !== 409) return false;
+            const body = await response.clone().json().catch(() => null);
+            return !!body && body.code === 'blocked';
+        }
+
+        function confirmCompleteBlocked(blockerIds) {
+            const waiting = blockerIds.filter(id => !tasks.some(t => t.id === id && t.completed)).map(taskTitle);
+            return confirm('This task is still waiting on:\n• ' + waiting.join('\n• ') + '\n\nComplete it anyway?');
+        }
+
+        function taskTitle(id) {
+            const task = tasks.find(t => t.id === id);
+            return task ? task.title : '#' + id;
+        }
+
+        // fillBlockedBy lists every other task as a possible blocker and
+        // selects the current ones
+        function fillBlockedBy(task) {
+            const select = document.getElementById('taskBlockedBy');
+            const current = task ? task.blocked_by || [] : [];
+            select.innerHTML = tasks.filter(t => !task || t.id !== task.id).map(t =>
+                '<option value="' + t.id + '"' + (current.includes(t.id) ? ' selected' : '') + '>' +
+                (t.completed ? '✓ ' : '') + escapeHtml(t.title) + '</option>').join('');
+        }
+
+        // fillResidents lists current residents, then former ones, keeping
+        // the task's resident even if they are no longer synced from Zoho
+        function fillResidents(task) {
+            const select = document.getElementById('taskResident');
+            const current = task ? task.resident_id || '' : '';
+            const label = r => escapeHtml(r.name + (r.unit ? ' (' + r.unit + ')' : ''));
+            let html = '<option value="">None</option>';
+            const groups = [['Current', residents.filter(r => r.current)], ['Former', residents.filter(r => !r.current)]];
+            groups.forEach(([name, list]) => {
+                if (list.length === 0) return;
+                html += '<optgroup label="' + name + '">' + list.map(r =>
+                    '<option value="' + escapeHtml(r.id) + '"' + (r.id === current ? ' selected' : '') + '>' + label(r) + '</option>').join('') + '</optgroup>';
+            });
+            if (current && !residents.some(r => r.id === current)) {
+                html += '<option value="' + escapeHtml(current) + '" selected>' + escapeHtml(task.resident_name || current) + '</option>';
+            }
+            select.innerHTML = html;
+        }
+
         function openAddTaskModal() {
             document.getElementById('modalTitle').textContent = 'Add New Task';
             document.getElementById('taskForm').reset();
             document.getElementById('taskId').value = '';
+            document.getElementById('taskVersion').value = '';
+            document.getElementById('taskParent').value = '';
+            setTypeOptions(null);
+            fillBlockedBy(null);
+            fillResidents(null);
+            setAdminFieldsEnabled(true);
+            document.getElementById('taskHistory').style.display = 'none';
             document.getElementById('taskModal').style.display = 'block';
         }
 
+        // setAdminFieldsEnabled locks the fields only an admin may change on
+        // an existing task, leaving notes and completion editable
+        function setAdminFieldsEnabled(enabled) {
+            ['taskTitle', 'taskType', 'taskOwner', 'taskPriority', 'taskDue', 'taskRecurrence', 'taskAutoComplete', 'taskBlockedBy', 'taskResident'].forEach(id => {
+                document.getElementById(id).disabled = !enabled;
+            });
+        }
+
         function editTask(taskId) {
             const task = tasks.find(t => t.id === taskId);
             if (task) {
                 document.getElementById('modalTitle').textContent = 'Edit Task';
                 document.getElementById('taskId').value = task.id;
+                document.getElementById('taskVersion').value = task.version;
                 document.getElementById('taskTitle').value = task.title;
+                setTypeOptions(task.type);
                 document.getElementById('taskType').value = task.type;
                 document.getElementById('taskOwner').value = task.owner;
                 document.getElementById('taskPriority').value = task.priority;
                 document.getElementById('taskNotes').value = task.notes || '';
+                document.getElementById('taskDue').value = task.due_at ? toDateInput(task.due_at) : '';
+                document.getElementById('taskRecurrence').value = task.recurrence || '';
                 document.getElementById('taskCompleted').checked = task.completed;
+                document.getElementById('taskAutoComplete').checked = !!task.auto_complete;
+                document.getElementById('taskParent').value = task.parent_id || '';
+                fillBlockedBy(task);
+                fillResidents(task);
+                setAdminFieldsEnabled(can('edit_task'));
+                loadHistory(task.id);
                 document.getElementById('taskModal').style.display = 'block';
             }
         }
 
+        // openAddSubtaskModal starts a new task under a parent, with the
+        // parent's type, owner, priority and resident filled in
+        function openAddSubtaskModal(parentId) {
+            const parent = tasks.find(t => t.id === parentId);
+            openAddTaskModal();
+            document.getElementById('modalTitle').textContent = 'Add Subtask of "' + parent.title + '"';
+            document.getElementById('taskParent').value = parentId;
+            document.getElementById('taskType').value = parent.type;
+            document.getElementById('taskOwner').value = parent.owner;
+            document.getElementById('taskPriority').value = parent.priority;
+            document.getElementById('taskResident').value = parent.resident_id || '';
+        }
+
+        // renderSteps shows a task's progress, checklist and subtasks
+        function renderSteps(task) {
+            const editable = canWorkOn(task);
+            let html = '';
+            if (task.parent_id) {
+                const parent = tasks.find(t => t.id === task.parent_id);
+                html += '<div class="task-subtasks">↳ Subtask of ' + escapeHtml(parent ? parent.title : '#' + task.parent_id) + '</div>';
+            }
+            if (task.blocked) {
+                html += '<div class="task-subtasks">⛔ Waiting on ' + task.open_blockers.map(id => escapeHtml(taskTitle(id))).join(', ') + '</div>';
+            }
+            if (task.progress) {
+                html += '<div class="task-progress" title="' + task.progress.done + ' of ' + task.progress.total + ' done">';
+                html += '<div style="width: ' + Math.round(task.progress.fraction * 100) + '%"></div></div>';
+            }
+            const items = task.checklist || [];
+            if (items.length > 0 || editable) {
+                html += '<ul class="checklist">';
+                items.forEach((item, i) => {
+                    html += '<li class="' + (item.done ? 'done' : '') + '">';
+                    html += '<input type="checkbox"' + (item.done ? ' checked' : '') + (editable ? '' : ' disabled') +
+                        ' onchange="checkItem(' + task.id + ', ' + item.id + ', this.checked)">';
+                    html += '<span>' + escapeHtml(item.text) + '</span>';
+                    if (editable) {
+                        if (i > 0) {
+                            html += '<a onclick="moveItem(' + task.id + ', ' + i + ')" title="Move up">▲</a>';
+                        }
+                        html += '<a onclick="deleteItem(' + task.id + ', ' + item.id + ')" title="Remove">✕</a>';
+                    }
+                    html += '</li>';
+                });
+                html += '</ul>';
+                if (editable) {
+                    html += '<form class="comment-form" onsubmit="addItem(event, ' + task.id + ')">';
+                    html += '<input type="text" placeholder="Add a checklist item..." required>';
+                    html += '<button type="submit" class="btn btn-secondary">Add</button>';
+                    html += '</form>';
+                }
+            }
+            const children = (task.subtasks || []).map(id => tasks.find(t => t.id === id)).filter(Boolean);
+            if (children.length > 0 || can('create_task')) {
+                html += '<div class="task-subtasks">';
+                if (children.length > 0) {
+                    html += 'Subtasks: ' + children.map(c => (c.completed ? '✅ ' : '⬜ ') + escapeHtml(c.title)).join(', ');
+                }
+                if (can('create_task')) {
+                    html += ' <a href="#" onclick="openAddSubtaskModal(' + task.id + '); return false;">+ Subtask</a>';
+                }
+                html += '</div>';
+            }
+            return html;
+        }
+
+        async function checklistRequest(url, method, body) {
+            const response = await apiFetch(url, {
+                method: method,
+                headers: { 'Content-Type': 'application/json' },
+                body: body === undefined ? undefined : JSON.stringify(body)
+            });
+            if (response.ok) {
+                loadTasks();
+            } else {
+                await showApiError(response);
+            }
+        }
+
+        function addItem(event, taskId) {
+            event.preventDefault();
+            const input = event.target.querySelector('input');
+            checklistRequest('/api/tasks/' + taskId + '/checklist', 'POST', { text: input.value });
+        }
+
+        function checkItem(taskId, itemId, done) {
+            checklistRequest('/api/tasks/' + taskId + '/checklist/' + itemId, 'PUT', { done: done });
+        }
+
+        function deleteItem(taskId, itemId) {
+            checklistRequest('/api/tasks/' + taskId + '/checklist/' + itemId, 'DELETE');
+        }
+
+        // moveItem swaps a checklist item with the one above it
+        function moveItem(taskId, index) {
+            const ids = tasks.find(t => t.id === taskId).checklist.map(item => item.id);
+            [ids[index - 1], ids[index]] = [ids[index], ids[index - 1]];
+            checklistRequest('/api/tasks/' + taskId + '/checklist/order', 'PUT', { ids: ids });
+        }
+
+        // toDateInput formats a timestamp as YYYY-MM-DD in local time
+        function toDateInput(value) {
+            const d = new Date(value);
+            return d.getFullYear() + '-' + String(d.getMonth() + 1).padStart(2, '0') + '-' + String(d.getDate()).padStart(2, '0');
+        }
+
+        // apiFetch calls the API with the session's CSRF token, going back to
+        // the sign-in page if the session has ended
+        async function apiFetch(url, options) {
+            options = options || {};
+            options.headers = Object.assign({}, options.headers, { 'X-CSRF-Token': session ? session.csrf_token : '' });
+            const response = await fetch(url, options);
+            if (response.status === 401) {
+                window.location.href = '/login';
+            }
+            return response;
+        }
+
+        function setView(view) {
+            localStorage.setItem('view', view);
+            renderTasks();
+        }
+
+        function setScope(scope) {
+            localStorage.setItem('scope', scope);
+            renderTasks();
+        }
+
+        async function logout() {
+            await apiFetch('/api/session', { method: 'DELETE' });
+            window.location.href = '/login';
+        }
+
+        async function loadHistory(taskId) {
+            const panel = document.getElementById('taskHistory');
+            try {
+                const response = await apiFetch('/api/tasks/' + taskId + '/history');
+                const events = await response.json();
+                let html = '<h3>History</h3>';
+                if (events.length === 0) {
+                    html += '<div class="history-entry">No changes recorded yet.</div>';
+                }
+                events.slice().reverse().forEach(event => {
+                    html += '<div class="history-entry">';
+                    html += '<div class="history-when">' + new Date(event.at).toLocaleString() + ' · ' + escapeHtml(event.actor) + '</div>';
+                    html += '<div>' + describeEvent(event) + '</div>';
+                    html += '</div>';
+                });
+                panel.innerHTML = html;
+                panel.style.display = 'block';
+            } catch (error) {
+                console.error('Error loading history:', error);
+            }
+        }
+
+        function describeEvent(event) {
+            if (event.action === 'created') return 'Created the task';
+            if (event.action === 'deleted') return 'Deleted the task';
+            if (event.action === 'toggled') {
+                return event.changes && event.changes.some(c => c.field === 'completed' && c.to) ? 'Marked complete' : 'Marked pending';
+            }
+            return (event.changes || []).map(c =>
+                'Changed <b>' + c.field + '</b> from "' + escapeHtml(formatValue(c.from)) + '" to "' + escapeHtml(formatValue(c.to)) + '"'
+            ).join('<br>') || 'Saved without changes';
+        }
+
+        function formatValue(value) {
+            if (value === null || value === undefined || value === '') return '—';
+            if (Array.isArray(value)) return value.join(', ');
+            return String(value);
+        }
+
+        // escapeHtml makes text safe to put in HTML, attribute values included
+        function escapeHtml(text) {
+            return String(text).replace(/[&<>"']/g, c =>
+                ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+        }
+
+        function toggleComments(taskId) {
+            if (openThreads.has(taskId)) {
+                openThreads.delete(taskId);
+                document.getElementById('comments-' + taskId).style.display = 'none';
+            } else {
+                openThreads.add(taskId);
+                loadComments(taskId);
+            }
+        }
+
+        async function loadComments(taskId) {
+            const thread = document.getElementById('comments-' + taskId);
+            if (!thread) return;
+            try {
+                const response = await apiFetch('/api/tasks/' + taskId + '/comments');
+                const list = await response.json();
+                let html = '';
+                list.forEach(comment => {
+                    html += '<div class="comment">';
+                    html += '<div class="comment-meta">' + escapeHtml(comment.author) + ' · ' + new Date(comment.created_at).toLocaleString();
+                    if (comment.edited_at) {
+                        html += ' (edited)';
+                    }
+                    if (comment.author_id === session.username) {
+                        html += '<a onclick="editComment(' + taskId + ', ' + comment.id + ')">edit</a>';
+                        html += '<a onclick="deleteComment(' + taskId + ', ' + comment.id + ')">delete</a>';
+                    }
+                    html += '</div>';
+                    html += '<div>' + highlightMentions(escapeHtml(comment.body)) + '</div>';
+                    html += '</div>';
+                });
+                if (can('comment')) {
+                    html += '<form class="comment-form" onsubmit="postComment(event, ' + taskId + ')">';
+                    html += '<input type="text" placeholder="Add a comment, @mention someone..." required>';
+                    html += '<button type="submit" class="btn btn-secondary">Post</button>';
+                    html += '</form>';
+                }
+                thread.innerHTML = html;
+                thread.style.display = 'block';
+                thread.dataset.comments = JSON.stringify(list);
+            } catch (error) {
+                console.error('Error loading comments:', error);
+            }
+        }
+
+        function highlightMentions(html) {
+            people.slice().sort((a, b) => b.name.length - a.name.length).forEach(person => {
+                const name = escapeHtml(person.name).replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+                html = html.replace(new RegExp('(^|[^\\w>])@' + name + '\\b', 'gi'), '$1<span class="mention">@' + escapeHtml(person.name) + '</span>');
+            });
+            return html;
+        }
+
+        async function postComment(event, taskId) {
+            event.preventDefault();
+            const input = event.target.querySelector('input');
+            const response = await apiFetch('/api/tasks/' + taskId + '/comments', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ body: input.value })
+            });
+            if (response.ok) {
+                loadTasks();
+            } else {
+                await showApiError(response);
+            }
+        }
+
+        async function editComment(taskId, commentId) {
+            const list = JSON.parse(document.getElementById('comments-' + taskId).dataset.comments || '[]');
+            const comment = list.find(c => c.id === commentId);
+            const body = prompt('Edit comment', comment ? comment.body : '');
+            if (body === null) return;
+            const response = await apiFetch('/api/tasks/' + taskId + '/comments/' + commentId, {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ body: body })
+            });
+            if (response.ok) {
+                loadComments(taskId);
+            } else {
+                await showApiError(response);
+            }
+        }
+
+        async function deleteComment(taskId, commentId) {
+            if (!confirm('Delete this comment?')) return;
+            const response = await apiFetch('/api/tasks/' + taskId + '/comments/' + commentId, { method: 'DELETE' });
+            if (response.ok) {
+                loadTasks();
+            } else {
+                await showApiError(response);
+            }
+        }
+
+        // showApiError reports an error response from the API to the user
+        async function showApiError(response) {
+            let message = 'Request failed (' + response.status + ')';
+            try {
+                const body = await response.json();
+                message = body.message;
+                (body.fields || []).forEach(f => {
+                    message += '\n• ' + f.field + ' ' + f.message;
+                });
+            } catch (error) {
+                // Not a JSON error body; keep the status message
+            }
+            alert(message);
+        }
+
         function closeTaskModal() {
             document.getElementById('taskModal').style.display = 'none';
         }
 
+        async function openNotificationsModal() {
+            const response = await apiFetch('/api/notifications');
+            if (!response.ok) {
+                await showApiError(response);
+                return;
+            }
+            const prefs = await response.json();
+            const hours = document.getElementById('notifyDigestHour');
+            if (hours.options.length === 0) {
+                for (let h = 0; h < 24; h++) {
+                    hours.add(new Option(String(h).padStart(2, '0') + ':00', h));
+                }
+            }
+            document.getElementById('notifyEmail').value = prefs.email || '';
+            document.getElementById('notifyAssigned').checked = prefs.assigned;
+            document.getElementById('notifyDueSoon').checked = prefs.due_soon;
+            document.getElementById('notifyOverdue').checked = prefs.overdue;
+            document.getElementById('notifyCompleted').checked = prefs.completed;
+            document.getElementById('notifyDigest').checked = prefs.digest;
+            hours.value = prefs.digest_hour;
+            document.getElementById('notificationsModal').style.display = 'block';
+        }
+
+        function closeNotificationsModal() {
+            document.getElementById('notificationsModal').style.display = 'none';
+        }
+
+        async function sendTestEmail() {
+            const response = await apiFetch('/api/notifications/test', { method: 'POST' });
+            if (!response.ok) {
+                await showApiError(response);
+                return;
+            }
+            const result = await response.json();
+            alert('Test email sent to ' + result.sent_to);
+        }
+
+        document.getElementById('notificationsForm').addEventListener('submit', async function(e) {
+            e.preventDefault();
+            const response = await apiFetch('/api/notifications', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    email: document.getElementById('notifyEmail').value.trim(),
+                    assigned: document.getElementById('notifyAssigned').checked,
+                    due_soon: document.getElementById('notifyDueSoon').checked,
+                    overdue: document.getElementById('notifyOverdue').checked,
+                    completed: document.getElementById('notifyCompleted').checked,
+                    digest: document.getElementById('notifyDigest').checked,
+                    digest_hour: parseInt(document.getElementById('notifyDigestHour').value, 10),
+                }),
+            });
+            if (!response.ok) {
+                await showApiError(response);
+                return;
+            }
+            closeNotificationsModal();
+        });
+
         async function deleteTask(taskId) {
             if (confirm('Are you sure you want to delete this task? This action cannot be undone.')) {
                 try {
-                    const response = await fetch('/api/tasks/' + taskId, {
+                    const response = await apiFetch('/api/tasks/' + taskId, {
                         method: 'DELETE',
                     });
                     if (response.ok) {
                         loadTasks();
+                    } else {
+                        await showApiError(response);
                     }
                 } catch (error) {
                     console.error('Error deleting task:', error);
@@ -901,15 +1957,34 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                 owner: document.getElementById('taskOwner').value,
                 priority: document.getElementById('taskPriority').value,
                 notes: document.getElementById('taskNotes').value,
-                completed: document.getElementById('taskCompleted').checked
+                recurrence: document.getElementById('taskRecurrence').value.trim(),
+                completed: document.getElementById('taskCompleted').checked,
+                auto_complete: document.getElementById('taskAutoComplete').checked,
+                parent_id: Number(document.getElementById('taskParent').value) || 0,
+                blocked_by: Array.from(document.getElementById('taskBlockedBy').selectedOptions, o => Number(o.value)),
+                resident_id: document.getElementById('taskResident').value,
+                version: Number(document.getElementById('taskVersion').value) || 0
             };
-
             const taskId = document.getElementById('taskId').value;
-            const url = taskId ? '/api/tasks/' + taskId : '/api/tasks';
+            const original = tasks.find(t => t.id === Number(taskId));
+            const due = document.getElementById('taskDue').value;
+            if (original && original.due_at && toDateInput(original.due_at) === due) {
+                // Keep the exact deadline when the day was not changed
+                taskData.due_at = original.due_at;
+            } else if (due) {
+                // Due at the end of the chosen day
+                taskData.due_at = new Date(due + 'T23:59:59').toISOString();
+            }
+
+            saveTask(taskId, taskData, false);
+        });
+
+        async function saveTask(taskId, taskData, force) {
+            const url = (taskId ? '/api/tasks/' + taskId : '/api/tasks') + (force ? '?force=true' : '');
             const method = taskId ? 'PUT' : 'POST';
 
             try {
-                const response = await fetch(url, {
+                const response = await apiFetch(url, {
                     method: method,
                     headers: {
                         'Content-Type': 'application/json',
@@ -920,11 +1995,22 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                 if (response.ok) {
                     closeTaskModal();
                     loadTasks();
+                } else if (await isBlockedError(response)) {
+                    if (confirmCompleteBlocked(taskData.blocked_by)) {
+                        saveTask(taskId, taskData, true);
+                    }
+                } else if (response.status === 409) {
+                    alert('Someone else changed this task while you were editing it. The latest version has been loaded.');
+                    closeTaskModal();
+                    await loadTasks();
+                    editTask(Number(taskId));
+                } else {
+                    await showApiError(response);
                 }
             } catch (error) {
                 console.error('Error saving task:', error);
             }
-        });
+        }
 
         // Close modal when clicking outside
         window.onclick = function(event) {
@@ -932,6 +2018,9 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
             if (event.target === modal) {
                 closeTaskModal();
             }
+            if (event.target === document.getElementById('notificationsModal')) {
+                closeNotificationsModal();
+            }
         }
     </script>
 </body>
@@ -945,105 +2034,218 @@ func tasksHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		json.NewEncoder(w).Encode(taskManager.Tasks)
+		query, err := parseTaskQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		page, total, next := query.Apply(viewTasks(taskManager.List(), time.Now()))
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if next != "" {
+			nextURL := *r.URL
+			params := nextURL.Query()
+			params.Set("cursor", next)
+			nextURL.RawQuery = params.Encode()
+			w.Header().Set("X-Next-Cursor", next)
+			w.Header().Set("Link", "<"+nextURL.RequestURI()+`>; rel="next"`)
+		}
+		json.NewEncoder(w).Encode(page)
 
 	case "POST":
+		if !requirePermission(w, r, PermCreateTask) {
+			return
+		}
 		var task Task
 		if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
 			return
 		}
 
-		task.ID = taskManager.NextID
-		task.CreatedAt = time.Now()
-		taskManager.NextID++
-		taskManager.Tasks = append(taskManager.Tasks, task)
+		task, err := taskManager.Create(r.Context(), task)
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
 
-		json.NewEncoder(w).Encode(task)
+		setETag(w, task)
+		json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
 	}
 }
 
 func taskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Extract task ID from URL
+	// Extract task ID and optional sub-resource from URL
 	path := r.URL.Path[len("/api/tasks/"):]
-	
+
 	if path == "" {
-		http.Error(w, "Task ID required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Task ID required")
 		return
 	}
 
-	// Handle toggle endpoint
-	if len(path) > 7 && path[len(path)-7:] == "/toggle" {
-		taskIDStr := path[:len(path)-7]
-		taskID, err := strconv.Atoi(taskIDStr)
-		if err != nil {
-			http.Error(w, "Invalid task ID", http.StatusBadRequest)
-			return
-		}
-
-		if r.Method == "POST" {
-			for i, task := range taskManager.Tasks {
-				if task.ID == taskID {
-					taskManager.Tasks[i].Completed = !task.Completed
-					if taskManager.Tasks[i].Completed {
-						now := time.Now()
-						taskManager.Tasks[i].CompletedAt = &now
-					} else {
-						taskManager.Tasks[i].CompletedAt = nil
-					}
-					json.NewEncoder(w).Encode(taskManager.Tasks[i])
-					return
-				}
-			}
-			http.Error(w, "Task not found", http.StatusNotFound)
-		}
+	taskIDStr, sub, _ := strings.Cut(path, "/")
+	taskID, err := strconv.Atoi(taskIDStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid task ID")
 		return
 	}
 
-	// Handle regular task operations
-	taskID, err := strconv.Atoi(path)
-	if err != nil {
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+	sub, rest, _ := strings.Cut(sub, "/")
+	switch sub {
+	case "":
+		// Handle regular task operations below
+	case "toggle":
+		toggleHandler(w, r, taskID)
+		return
+	case "move":
+		moveHandler(w, r, taskID)
+		return
+	case "history":
+		taskHistoryHandler(w, r, taskID)
+		return
+	case "comments":
+		commentsHandler(w, r, taskID, rest)
+		return
+	case "checklist":
+		checklistHandler(w, r, taskID, rest)
+		return
+	case "subtasks":
+		subtasksHandler(w, r, taskID)
+		return
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
 		return
 	}
 
 	switch r.Method {
+	case "GET":
+		task, err := taskManager.Get(taskID)
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		setETag(w, task)
+		json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+
 	case "PUT":
+		if !requireTaskAccess(w, r, taskID) {
+			return
+		}
 		var updatedTask Task
 		if err := json.NewDecoder(r.Body).Decode(&updatedTask); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
 			return
 		}
 
-		for i, task := range taskManager.Tasks {
-			if task.ID == taskID {
-				updatedTask.ID = taskID
-				updatedTask.CreatedAt = task.CreatedAt
-				if updatedTask.Completed && !task.Completed {
-					now := time.Now()
-					updatedTask.CompletedAt = &now
-				} else if !updatedTask.Completed {
-					updatedTask.CompletedAt = nil
-				} else {
-					updatedTask.CompletedAt = task.CompletedAt
-				}
-				taskManager.Tasks[i] = updatedTask
-				json.NewEncoder(w).Encode(updatedTask)
+		// An If-Match header takes precedence over the version in the body
+		version := updatedTask.Version
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			version, err = parseETag(ifMatch)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid If-Match header")
 				return
 			}
 		}
-		http.Error(w, "Task not found", http.StatusNotFound)
+
+		task, err := taskManager.Update(completionContext(r), taskID, updatedTask, version)
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		setETag(w, task)
+		json.NewEncoder(w).Encode(viewTask(task, time.Now()))
 
 	case "DELETE":
-		for i, task := range taskManager.Tasks {
-			if task.ID == taskID {
-				taskManager.Tasks = append(taskManager.Tasks[:i], taskManager.Tasks[i+1:]...)
-				w.WriteHeader(http.StatusNoContent)
-				return
-			}
+		if !requirePermission(w, r, PermDeleteTask) {
+			return
 		}
-		http.Error(w, "Task not found", http.StatusNotFound)
+		if err := taskManager.Delete(r.Context(), taskID); err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, r, "GET", "PUT", "DELETE")
+	}
+}
+
+// toggleHandler serves POST /api/tasks/{id}/toggle
+func toggleHandler(w http.ResponseWriter, r *http.Request, taskID int) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !requireTaskAccess(w, r, taskID) {
+		return
+	}
+	task, err := taskManager.Toggle(completionContext(r), taskID)
+	if err != nil {
+		writeTaskError(w, err)
+		return
 	}
-}
\ No newline at end of file
+	setETag(w, task)
+	json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+}
+
+// taskHistoryHandler serves GET /api/tasks/{id}/history. History outlives
+// the task, so it is available for deleted tasks too.
+func taskHistoryHandler(w http.ResponseWriter, r *http.Request, taskID int) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	events := history.ForTask(taskID)
+	if len(events) == 0 {
+		if _, err := taskManager.Get(taskID); err != nil {
+			writeTaskError(w, err)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+// writeTaskError maps TaskManager errors to HTTP status codes
+func writeTaskError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrTaskNotFound):
+		writeError(w, http.StatusNotFound, "Task not found")
+	case errors.Is(err, ErrChecklistItemNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrBlocked):
+		writeAPIError(w, http.StatusConflict, APIError{
+			Code:    "blocked",
+			Message: err.Error() + "; complete them first or retry with ?force=true",
+		})
+	case errors.Is(err, ErrHasSubtasks):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrVersionConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// setETag exposes the task version as a strong ETag
+func setETag(w http.ResponseWriter, task Task) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(task.Version)+`"`)
+}
+
+// parseETag reads a version from an If-Match value; "*" matches any version
+func parseETag(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return 0, nil
+	}
+	value = strings.TrimPrefix(value, "W/")
+	return strconv.Atoi(strings.Trim(value, `"`))
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of notification
+const (
+	NoticeAssigned  = "assigned"  // a task was created for or reassigned to someone
+	NoticeDueSoon   = "due_soon"  // an open task is within dueSoonWindow of its due date
+	NoticeOverdue   = "overdue"   // an open task is past its due date
+	NoticeCompleted = "completed" // someone else completed a task
+)
+
+const (
+	// reminderInterval is how often due dates and digests are checked.
+	reminderInterval = 5 * time.Minute
+	// sentReminderAge is how long a sent reminder is remembered.
+	sentReminderAge = 60 * 24 * time.Hour
+	// defaultDigestHour is when, local time, daily digests go out.
+	defaultDigestHour = 7
+)
+
+// Mail is a plain-text email.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// SMTPMailer sends email through an SMTP server. Any server that accepts
+// mail will do, including a local stand-in such as MailHog for testing.
+type SMTPMailer struct {
+	Addr     string // host:port
+	From     string
+	Username string // empty for servers that need no login
+	Password string
+}
+
+// Send delivers mail, using STARTTLS when the server offers it.
+func (m SMTPMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(mail.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return smtp.SendMail(m.Addr, auth, m.From, []string{mail.To}, []byte(b.String()))
+}
+
+// logMailer writes email to the log instead of sending it, for servers
+// run without -smtp.
+type logMailer struct{}
+
+func (logMailer) Send(mail Mail) error {
+	log.Printf("notify: no SMTP server set; not sending %q to %s", mail.Subject, mail.To)
+	return nil
+}
+
+// NotificationPrefs are one person's email settings. People who have never
+// saved any get defaultPrefs.
+type NotificationPrefs struct {
+	PersonID   PersonID `json:"person_id"`
+	Email      string   `json:"email,omitempty"` // overrides the email in the People registry
+	Assigned   bool     `json:"assigned"`
+	DueSoon    bool     `json:"due_soon"`
+	Overdue    bool     `json:"overdue"`
+	Completed  bool     `json:"completed"`
+	Digest     bool     `json:"digest"`      // collect notices into one email a day
+	DigestHour int      `json:"digest_hour"` // local hour the digest is sent
+}
+
+// Wants reports whether the prefs ask for notices of a kind.
+func (p NotificationPrefs) Wants(kind string) bool {
+	switch kind {
+	case NoticeAssigned:
+		return p.Assigned
+	case NoticeDueSoon:
+		return p.DueSoon
+	case NoticeOverdue:
+		return p.Overdue
+	case NoticeCompleted:
+		return p.Completed
+	}
+	return false
+}
+
+func defaultPrefs(id PersonID) NotificationPrefs {
+	return NotificationPrefs{PersonID: id, Assigned: true, DueSoon: true, Overdue: true, Completed: true, DigestHour: defaultDigestHour}
+}
+
+// Notice is something to tell one person about a task.
+type Notice struct {
+	PersonID PersonID  `json:"person_id"`
+	Kind     string    `json:"kind"`
+	TaskID   int       `json:"task_id"`
+	Text     string    `json:"text"`
+	At       time.Time `json:"at"`
+}
+
+// notifierState is what the Notifier keeps in the store.
+type notifierState struct {
+	Prefs []NotificationPrefs `json:"prefs"`
+	// Sent records due-date reminders already sent, so each goes out once
+	// per due date. Keys look like "overdue:12:2025-06-01T17:00:00Z".
+	Sent map[string]time.Time `json:"sent"`
+	// Digests holds notices for people who get a daily digest, and
+	// LastDigest when each of them last got one.
+	Digests    []Notice               `json:"digests,omitempty"`
+	LastDigest map[PersonID]time.Time `json:"last_digest,omitempty"`
+}
+
+// Notifier emails task owners about changes to their tasks and upcoming
+// due dates.
+type Notifier struct {
+	mu      sync.Mutex
+	store   Store
+	mailer  Mailer
+	baseURL string
+	state   notifierState
+	events  chan TaskEvent
+}
+
+// notifier sends email notifications
+var notifier *Notifier
+
+// NewNotifier loads preferences and reminder state from store.
+func NewNotifier(store Store, mailer Mailer, baseURL string) (*Notifier, error) {
+	var state notifierState
+	if _, err := store.Load("notifications", &state); err != nil {
+		return nil, err
+	}
+	if state.Sent == nil {
+		state.Sent = map[string]time.Time{}
+	}
+	if state.LastDigest == nil {
+		state.LastDigest = map[PersonID]time.Time{}
+	}
+	return &Notifier{
+		store:   store,
+		mailer:  mailer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		state:   state,
+		events:  make(chan TaskEvent, 256),
+	}, nil
+}
+
+// save persists the state. Callers must hold n.mu.
+func (n *Notifier) save() {
+	if err := n.store.Save("notifications", n.state); err != nil {
+		log.Printf("notify: saving state: %v", err)
+	}
+}
+
+// Prefs returns a person's settings.
+func (n *Notifier) Prefs(id PersonID) NotificationPrefs {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.prefs(id)
+}
+
+// prefs returns a person's settings. Callers must hold n.mu.
+func (n *Notifier) prefs(id PersonID) NotificationPrefs {
+	i := slices.IndexFunc(n.state.Prefs, func(p NotificationPrefs) bool { return p.PersonID == id })
+	if i < 0 {
+		return defaultPrefs(id)
+	}
+	return n.state.Prefs[i]
+}
+
+// SetPrefs saves a person's settings.
+func (n *Notifier) SetPrefs(p NotificationPrefs) (NotificationPrefs, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	list := slices.Clone(n.state.Prefs)
+	if i := slices.IndexFunc(list, func(q NotificationPrefs) bool { return q.PersonID == p.PersonID }); i >= 0 {
+		list[i] = p
+	} else {
+		list = append(list, p)
+	}
+	state := n.state
+	state.Prefs = list
+	if err := n.store.Save("notifications", state); err != nil {
+		return NotificationPrefs{}, err
+	}
+	n.state = state
+	return p, nil
+}
+
+// Address returns where a person's email goes, or "" if they have no address.
+func (n *Notifier) Address(id PersonID) string {
+	if p := n.Prefs(id); p.Email != "" {
+		return p.Email
+	}
+	person, err := people.Get(id)
+	if err != nil {
+		return ""
+	}
+	return person.Email
+}
+
+// Notify queues a task event. It is a TaskManager listener, so it must not
+// block or call back into the manager; Run does the work.
+func (n *Notifier) Notify(event TaskEvent) {
+	select {
+	case n.events <- event:
+	default:
+		log.Printf("notify: queue full, dropping %s of task %d", event.Action, event.TaskID)
+	}
+}
+
+// Run handles queued events and checks due dates and digests until the
+// process exits.
+func (n *Notifier) Run() {
+	n.tick(time.Now())
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-n.events:
+			n.handle(event)
+		case now := <-ticker.C:
+			n.tick(now)
+		}
+	}
+}
+
+// handle turns a task event into notices for the task's owners, leaving out
+// whoever made the change.
+func (n *Notifier) handle(event TaskEvent) {
+	var kind string
+	var recipients []PersonID
+	for _, c := range event.Changes {
+		switch {
+		case c.Field == "owners":
+			before, _ := c.From.([]PersonID)
+			after, _ := c.To.([]PersonID)
+			for _, id := range after {
+				if !slices.Contains(before, id) {
+					recipients = append(recipients, id)
+				}
+			}
+			if len(recipients) > 0 {
+				kind = NoticeAssigned
+			}
+		case c.Field == "completed" && c.To == true && kind == "":
+			kind = NoticeCompleted
+		}
+	}
+	if kind == "" || event.Action == ActionDeleted {
+		return
+	}
+	task, err := taskManager.Get(event.TaskID)
+	if err != nil {
+		return
+	}
+	if kind == NoticeCompleted {
+		recipients = task.Owners
+	}
+
+	var text string
+	switch {
+	case event.Action == ActionCreated:
+		text = fmt.Sprintf("%s added a task for you: %s", event.Actor, task.Title)
+	case kind == NoticeAssigned:
+		text = fmt.Sprintf("%s assigned you a task: %s", event.Actor, task.Title)
+	default:
+		text = fmt.Sprintf("%s completed: %s", event.Actor, task.Title)
+	}
+	for _, id := range recipients {
+		if person, err := people.Get(id); err == nil && person.Name == event.Actor {
+			continue
+		}
+		n.deliver(Notice{PersonID: id, Kind: kind, TaskID: task.ID, Text: text, At: event.At}, task)
+	}
+}
+
+// tick sends due-date reminders that have not been sent yet, then any
+// digests that are due.
+func (n *Notifier) tick(now time.Time) {
+	for _, task := range taskManager.List() {
+		if task.Completed || task.DueAt == nil {
+			continue
+		}
+		v := viewTask(task, now)
+		var kind, text string
+		switch {
+		case v.Overdue:
+			kind, text = NoticeOverdue, "Overdue: "+task.Title
+		case v.DueSoon:
+			kind, text = NoticeDueSoon, "Due soon: "+task.Title
+		default:
+			continue
+		}
+		key := fmt.Sprintf("%s:%d:%s", kind, task.ID, task.DueAt.UTC().Format(time.RFC3339))
+		n.mu.Lock()
+		_, sent := n.state.Sent[key]
+		if !sent {
+			n.state.Sent[key] = now
+			n.save()
+		}
+		n.mu.Unlock()
+		if sent {
+			continue
+		}
+		for _, id := range task.Owners {
+			n.deliver(Notice{PersonID: id, Kind: kind, TaskID: task.ID, Text: text, At: now}, task)
+		}
+	}
+
+	n.mu.Lock()
+	for key, at := range n.state.Sent {
+		if now.Sub(at) > sentReminderAge {
+			delete(n.state.Sent, key)
+		}
+	}
+	n.mu.Unlock()
+	n.sendDigests(now)
+}
+
+// deliver emails a notice at once or keeps it for the person's digest,
+// as their preferences say.
+func (n *Notifier) deliver(notice Notice, task Task) {
+	prefs := n.Prefs(notice.PersonID)
+	if !prefs.Wants(notice.Kind) {
+		return
+	}
+	to := n.Address(notice.PersonID)
+	if to == "" {
+		return
+	}
+	if prefs.Digest {
+		n.mu.Lock()
+		n.state.Digests = append(n.state.Digests, notice)
+		n.save()
+		n.mu.Unlock()
+		return
+	}
+	n.send(Mail{To: to, Subject: notice.Text, Body: n.describe(task) + n.footer()})
+}
+
+// sendDigests emails each digest reader their notices once a day, after
+// their digest hour.
+func (n *Notifier) sendDigests(now time.Time) {
+	n.mu.Lock()
+	byPerson := map[PersonID][]Notice{}
+	for _, notice := range n.state.Digests {
+		byPerson[notice.PersonID] = append(byPerson[notice.PersonID], notice)
+	}
+	var due []PersonID
+	local := now.In(time.Local)
+	for id := range byPerson {
+		// Notices kept for someone who has since turned digests off go at once
+		prefs := n.prefs(id)
+		sendAt := time.Date(local.Year(), local.Month(), local.Day(), prefs.DigestHour, 0, 0, 0, time.Local)
+		if !prefs.Digest || !local.Before(sendAt) && n.state.LastDigest[id].Before(sendAt) {
+			due = append(due, id)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, id := range due {
+		to := n.Address(id)
+		notices := byPerson[id]
+		sort.SliceStable(notices, func(i, j int) bool { return notices[i].At.Before(notices[j].At) })
+		var b strings.Builder
+		fmt.Fprintf(&b, "Here is what happened to your tasks since the last digest.\n\n")
+		for _, notice := range notices {
+			fmt.Fprintf(&b, "- %s (task %d, %s)\n", notice.Text, notice.TaskID, notice.At.In(time.Local).Format("2 Jan 15:04"))
+		}
+		if to != "" {
+			subject := "Your task digest: 1 update"
+			if len(notices) > 1 {
+				subject = fmt.Sprintf("Your task digest: %d updates", len(notices))
+			}
+			if !n.send(Mail{To: to, Subject: subject, Body: b.String() + n.footer()}) {
+				continue
+			}
+		}
+
+		n.mu.Lock()
+		n.state.Digests = slices.DeleteFunc(n.state.Digests, func(notice Notice) bool { return notice.PersonID == id })
+		n.state.LastDigest[id] = now
+		n.save()
+		n.mu.Unlock()
+	}
+}
+
+// describe lists a task's details for an email.
+func (n *Notifier) describe(task Task) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", task.Title)
+	fmt.Fprintf(&b, "Owner:    %s\n", task.Owner)
+	fmt.Fprintf(&b, "Type:     %s\n", task.Type)
+	fmt.Fprintf(&b, "Priority: %s\n", task.Priority)
+	if task.DueAt != nil {
+		fmt.Fprintf(&b, "Due:      %s\n", task.DueAt.In(time.Local).Format("Mon 2 Jan 2006 15:04"))
+	}
+	if task.Notes != "" {
+		fmt.Fprintf(&b, "\n%s\n", task.Notes)
+	}
+	return b.String()
+}
+
+func (n *Notifier) footer() string {
+	return fmt.Sprintf("\n--\nOpen the task list: %s/\nChange which emails you get under Notifications on the dashboard.\n", n.baseURL)
+}
+
+// send emails mail, logging failures. It reports whether it succeeded.
+func (n *Notifier) send(mail Mail) bool {
+	if err := n.mailer.Send(mail); err != nil {
+		log.Printf("notify: sending %q to %s: %v", mail.Subject, mail.To, err)
+		return false
+	}
+	return true
+}
+
+// notificationsHandler serves /api/notifications, the signed-in person's
+// email settings, and POST /api/notifications/test, which sends them a
+// test email.
+func notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	account, _ := accountFrom(r.Context())
+	if account.PersonID == "" {
+		writeError(w, http.StatusConflict, "Your account is not linked to a person, so it gets no email")
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/notifications"), "/") {
+	case "":
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(notifier.Prefs(account.PersonID))
+
+		case "PUT":
+			var prefs NotificationPrefs
+			if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			prefs.PersonID = account.PersonID
+			prefs.Email = strings.TrimSpace(prefs.Email)
+			if err := validateNotificationPrefs(prefs); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			prefs, err := notifier.SetPrefs(prefs)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			json.NewEncoder(w).Encode(prefs)
+
+		default:
+			methodNotAllowed(w, r, "GET", "PUT")
+		}
+
+	case "test":
+		if r.Method != "POST" {
+			methodNotAllowed(w, r, "POST")
+			return
+		}
+		to := notifier.Address(account.PersonID)
+		if to == "" {
+			writeError(w, http.StatusConflict, "No email address is set for you")
+			return
+		}
+		err := notifier.mailer.Send(Mail{
+			To:      to,
+			Subject: "Test email from AMSKU Task Management",
+			Body:    "Email notifications are working." + notifier.footer(),
+		})
+		if err != nil {
+			writeError(w, http.StatusBadGateway, "Sending failed: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"sent_to": to})
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStub is a local SMTP server that accepts every message it is sent.
+type smtpStub struct {
+	addr  string
+	mu    sync.Mutex
+	mails []Mail
+}
+
+func startSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpStub{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := textproto.NewReader(bufio.NewReader(conn))
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 stub ESMTP")
+	var to string
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<> ")
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := r.ReadDotLines()
+			if err != nil {
+				return
+			}
+			mail := Mail{To: to}
+			for i, l := range lines {
+				if l == "" {
+					mail.Body = strings.Join(lines[i+1:], "\n")
+					break
+				}
+				if subject, ok := strings.CutPrefix(l, "Subject: "); ok {
+					mail.Subject = subject
+				}
+			}
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default: // EHLO, HELO, MAIL, RSET, NOOP
+			reply("250 OK")
+		}
+	}
+}
+
+// take returns the mail received since the last call.
+func (s *smtpStub) take() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mails := s.mails
+	s.mails = nil
+	return mails
+}
+
+// newTestNotifier returns a Notifier sending to a new SMTP stub.
+func newTestNotifier(t *testing.T) (*Notifier, *smtpStub) {
+	t.Helper()
+	store := newTestStore(t)
+	stub := startSMTPStub(t)
+	n, err := NewNotifier(store, SMTPMailer{Addr: stub.addr, From: "tasks@example.com"}, "http://tasks.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier = n
+	return n, stub
+}
+
+// recipients lists who the mails went to, each with its subject.
+func recipients(mails []Mail) map[string]string {
+	got := map[string]string{}
+	for _, m := range mails {
+		got[m.To] = m.Subject
+	}
+	return got
+}
+
+func TestNotifierFollowsPreferences(t *testing.T) {
+	n, stub := newTestNotifier(t)
+	ana := addPerson(t, "Ana", "ana@example.com")
+	ben := addPerson(t, "Ben", "ben@example.com")
+	colin := addPerson(t, "Colin", "colin@example.com")
+	prefs := defaultPrefs(ben.ID)
+	prefs.Assigned = false
+	if _, err := n.SetPrefs(prefs); err != nil {
+		t.Fatal(err)
+	}
+	taskManager.Subscribe(n.Notify)
+
+	// Colin made the task, so only Ana hears about it: Ben turned
+	// assignment emails off
+	task := createTask(t, withActor(context.Background(), "Colin"), Task{Title: "Fix the gate", Owners: []PersonID{ana.ID, ben.ID, colin.ID}})
+	n.handle(<-n.events)
+	got := recipients(stub.take())
+	want := map[string]string{"ana@example.com": "Colin added a task for you: Fix the gate"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("assignment mail = %v, want %v", got, want)
+	}
+
+	task.Completed = true
+	if _, err := taskManager.Update(withActor(context.Background(), "Ana"), task.ID, task, task.Version); err != nil {
+		t.Fatal(err)
+	}
+	n.handle(<-n.events)
+	got = recipients(stub.take())
+	want = map[string]string{
+		"ben@example.com":   "Ana completed: Fix the gate",
+		"colin@example.com": "Ana completed: Fix the gate",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("completion mail = %v, want %v", got, want)
+	}
+}
+
+func TestNotifierSendsDueRemindersOnce(t *testing.T) {
+	n, stub := newTestNotifier(t)
+	ana := addPerson(t, "Ana", "ana@example.com")
+	now := time.Now()
+	soon, past := now.Add(2*time.Hour), now.Add(-time.Hour)
+	createTask(t, context.Background(), Task{Title: "Book the plumber", Owners: []PersonID{ana.ID}, DueAt: &soon})
+	createTask(t, context.Background(), Task{Title: "Pay the deposit", Owners: []PersonID{ana.ID}, DueAt: &past})
+	createTask(t, context.Background(), Task{Title: "Plan the summer party", Owners: []PersonID{ana.ID}})
+
+	n.tick(now)
+	var subjects []string
+	for _, m := range stub.take() {
+		if m.To != "ana@example.com" {
+			t.Errorf("reminder sent to %s", m.To)
+		}
+		if !strings.Contains(m.Body, "http://tasks.example.com/") {
+			t.Errorf("reminder %q has no link to the dashboard", m.Subject)
+		}
+		subjects = append(subjects, m.Subject)
+	}
+	if want := "[Due soon: Book the plumber Overdue: Pay the deposit]"; fmt.Sprint(subjects) != want {
+		t.Errorf("reminders = %v, want %s", subjects, want)
+	}
+
+	n.tick(now.Add(reminderInterval))
+	if mails := stub.take(); len(mails) != 0 {
+		t.Errorf("reminders were sent again: %v", recipients(mails))
+	}
+}
+
+func TestNotifierCollectsDigest(t *testing.T) {
+	n, stub := newTestNotifier(t)
+	dee := addPerson(t, "Dee", "dee@example.com")
+	prefs := defaultPrefs(dee.ID)
+	prefs.Digest, prefs.DigestHour = true, 7
+	if _, err := n.SetPrefs(prefs); err != nil {
+		t.Fatal(err)
+	}
+	taskManager.Subscribe(n.Notify)
+
+	ctx := withActor(context.Background(), "Colin")
+	task := createTask(t, ctx, Task{Title: "Inspect unit 4A", Owners: []PersonID{dee.ID}})
+	n.handle(<-n.events)
+	task.Completed = true
+	if _, err := taskManager.Update(ctx, task.ID, task, task.Version); err != nil {
+		t.Fatal(err)
+	}
+	n.handle(<-n.events)
+	if mails := stub.take(); len(mails) != 0 {
+		t.Fatalf("digest reader was emailed at once: %v", recipients(mails))
+	}
+
+	today := time.Now().In(time.Local)
+	at := func(hour int) time.Time {
+		return time.Date(today.Year(), today.Month(), today.Day(), hour, 0, 0, 0, time.Local)
+	}
+	n.sendDigests(at(6))
+	if mails := stub.take(); len(mails) != 0 {
+		t.Fatalf("digest sent before its hour: %v", recipients(mails))
+	}
+
+	n.sendDigests(at(8))
+	mails := stub.take()
+	if len(mails) != 1 || mails[0].To != "dee@example.com" || mails[0].Subject != "Your task digest: 2 updates" {
+		t.Fatalf("digest = %v, want one mail to dee@example.com with 2 updates", mails)
+	}
+	for _, text := range []string{"Colin added a task for you: Inspect unit 4A", "Colin completed: Inspect unit 4A"} {
+		if !strings.Contains(mails[0].Body, text) {
+			t.Errorf("digest does not mention %q:\n%s", text, mails[0].Body)
+		}
+	}
+
+	n.sendDigests(at(9))
+	if mails := stub.take(); len(mails) != 0 {
+		t.Errorf("digest sent twice: %v", recipients(mails))
+	}
+}
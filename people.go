@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PersonID identifies a person in the People registry. It is a slug of
+// the person's name when they were first added.
+type PersonID string
+
+// Person is someone tasks can be assigned to.
+type Person struct {
+	ID    PersonID `json:"id"`
+	Name  string   `json:"name"`
+	Email string   `json:"email,omitempty"`
+}
+
+var (
+	// ErrPersonNotFound is returned when no person has the requested ID.
+	ErrPersonNotFound = errors.New("person not found")
+	// ErrPersonExists is returned when adding a person whose name is taken.
+	ErrPersonExists = errors.New("a person with that name already exists")
+	// ErrPersonAssigned is returned when deleting someone who still owns tasks.
+	ErrPersonAssigned = errors.New("person is still assigned to tasks")
+)
+
+// ownerSeparator splits legacy owner strings such as "Liz, Tariro & Endri".
+var ownerSeparator = regexp.MustCompile(`\s*(?:&|,|\band\b)\s*`)
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// PeopleRegistry holds everyone tasks can be assigned to.
+type PeopleRegistry struct {
+	mu     sync.RWMutex
+	store  Store
+	people []Person
+}
+
+// people holds the registry of task owners
+var people *PeopleRegistry
+
+// NewPeopleRegistry loads the registry from store.
+func NewPeopleRegistry(store Store) (*PeopleRegistry, error) {
+	list := []Person{}
+	if _, err := store.Load("people", &list); err != nil {
+		return nil, err
+	}
+	return &PeopleRegistry{store: store, people: list}, nil
+}
+
+// commit writes the People registry and uses the new list once it is saved.
+// Callers must hold r.mu for writing.
+func (r *PeopleRegistry) commit(list []Person) error {
+	if err := r.store.Save("people", list); err != nil {
+		return err
+	}
+	r.people = list
+	return nil
+}
+
+// List returns everyone, sorted by name.
+func (r *PeopleRegistry) List() []Person {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := append([]Person{}, r.people...)
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list
+}
+
+// Names returns the names of everyone in the registry.
+func (r *PeopleRegistry) Names() []string {
+	var names []string
+	for _, p := range r.List() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Get returns the person with the given ID.
+func (r *PeopleRegistry) Get(id PersonID) (Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.people {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Person{}, ErrPersonNotFound
+}
+
+// Lookup finds a person by ID or by name, ignoring case.
+func (r *PeopleRegistry) Lookup(idOrName string) (Person, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return findPerson(r.people, idOrName)
+}
+
+func findPerson(list []Person, idOrName string) (Person, bool) {
+	for _, p := range list {
+		if string(p.ID) == idOrName || strings.EqualFold(p.Name, idOrName) {
+			return p, true
+		}
+	}
+	return Person{}, false
+}
+
+// Create adds a new person.
+func (r *PeopleRegistry) Create(p Person) (Person, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.Name = strings.TrimSpace(p.Name)
+	for _, existing := range r.people {
+		if strings.EqualFold(existing.Name, p.Name) {
+			return Person{}, ErrPersonExists
+		}
+	}
+	p.ID = newPersonID(r.people, p.Name)
+	if err := r.commit(append(append([]Person{}, r.people...), p)); err != nil {
+		return Person{}, err
+	}
+	return p, nil
+}
+
+// Update changes a person's name and email. Their ID stays the same so
+// task assignments follow the rename.
+func (r *PeopleRegistry) Update(id PersonID, p Person) (Person, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.ID = id
+	p.Name = strings.TrimSpace(p.Name)
+	list := append([]Person{}, r.people...)
+	i := -1
+	for j, existing := range list {
+		if existing.ID == id {
+			i = j
+		} else if strings.EqualFold(existing.Name, p.Name) {
+			return Person{}, ErrPersonExists
+		}
+	}
+	if i < 0 {
+		return Person{}, ErrPersonNotFound
+	}
+	list[i] = p
+	if err := r.commit(list); err != nil {
+		return Person{}, err
+	}
+	return p, nil
+}
+
+// Delete removes a person from the registry.
+func (r *PeopleRegistry) Delete(id PersonID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, p := range r.people {
+		if p.ID == id {
+			return r.commit(append(append([]Person{}, r.people[:i]...), r.people[i+1:]...))
+		}
+	}
+	return ErrPersonNotFound
+}
+
+// DeletePerson removes someone who owns no tasks from the People registry.
+// Both happen under the task lock, so no task is assigned to them between
+// the check and the removal.
+func (m *TaskManager) DeletePerson(id PersonID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, task := range m.tasks {
+		if task.HasOwner(id) {
+			return ErrPersonAssigned
+		}
+	}
+	return m.people.Delete(id)
+}
+
+// Match turns an owner string such as "Tariro & Endri" into person IDs.
+// Names that match nobody in the registry are returned as unknown.
+func (r *PeopleRegistry) Match(owner string) (ids []PersonID, unknown []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range ownerSeparator.Split(strings.TrimSpace(owner), -1) {
+		if name == "" {
+			continue
+		}
+		p, ok := findPerson(r.people, name)
+		if !ok {
+			unknown = append(unknown, name)
+		} else if !slices.Contains(ids, p.ID) {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids, unknown
+}
+
+// unknownOwnerError reports owner names that match nobody in the registry.
+func unknownOwnerError(unknown []string) FieldError {
+	return FieldError{Field: "owner", Message: fmt.Sprintf("unknown person %s; add them to People first", strings.Join(quoteAll(unknown), ", "))}
+}
+
+func quoteAll(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return quoted
+}
+
+// Resolve turns a legacy owner string into person IDs, adding anyone not
+// yet in the registry. It is only for migrating tasks saved or seeded
+// before the registry existed; other callers use Match.
+func (r *PeopleRegistry) Resolve(owner string) ([]PersonID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		ids   []PersonID
+		added bool
+		list  = append([]Person{}, r.people...)
+	)
+	for _, name := range ownerSeparator.Split(strings.TrimSpace(owner), -1) {
+		if name == "" {
+			continue
+		}
+		p, ok := findPerson(list, name)
+		if !ok {
+			p = Person{ID: newPersonID(list, name), Name: name}
+			list = append(list, p)
+			added = true
+		}
+		if !slices.Contains(ids, p.ID) {
+			ids = append(ids, p.ID)
+		}
+	}
+	if added {
+		if err := r.commit(list); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// DisplayName joins the names of the given people, e.g. "Liz, Tariro & Endri".
+func (r *PeopleRegistry) DisplayName(ids []PersonID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for _, id := range ids {
+		if p, ok := findPerson(r.people, string(id)); ok {
+			names = append(names, p.Name)
+		} else {
+			names = append(names, string(id))
+		}
+	}
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " & " + names[len(names)-1]
+	}
+}
+
+// newPersonID derives an ID from name that is not used in list.
+func newPersonID(list []Person, name string) PersonID {
+	base := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "person"
+	}
+	id := PersonID(base)
+	for n := 2; ; n++ {
+		if _, taken := findPerson(list, string(id)); !taken {
+			return id
+		}
+		id = PersonID(base + "-" + strconv.Itoa(n))
+	}
+}
+
+// peopleHandler serves /api/people and /api/people/{id}
+func peopleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !safeMethod(r.Method) && !requirePermission(w, r, PermManagePeople) {
+		return
+	}
+
+	id := PersonID(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/people"), "/"))
+	if id == "" {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(people.List())
+
+		case "POST":
+			var p Person
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			if err := validatePerson(p); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			p, err := people.Create(p)
+			if err != nil {
+				writePersonError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(p)
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		p, err := people.Get(id)
+		if err != nil {
+			writePersonError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+
+	case "PUT":
+		var p Person
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		if err := validatePerson(p); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		p, err := people.Update(id, p)
+		if err != nil {
+			writePersonError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+
+	case "DELETE":
+		if err := taskManager.DeletePerson(id); err != nil {
+			writePersonError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, r, "GET", "PUT", "DELETE")
+	}
+}
+
+// writePersonError maps PeopleRegistry errors to HTTP status codes
+func writePersonError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPersonNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrPersonExists), errors.Is(err, ErrPersonAssigned):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestDeletePersonWhileAssigning(t *testing.T) {
+	newTestStore(t)
+	ctx := context.Background()
+	ana := addPerson(t, "Ana", "")
+	bo := addPerson(t, "Bo", "")
+	createTask(t, ctx, Task{Title: "Fix the gate", Owner: "Bo"})
+	if err := taskManager.DeletePerson(bo.ID); !errors.Is(err, ErrPersonAssigned) {
+		t.Errorf("deleting someone who owns a task: error = %v, want %v", err, ErrPersonAssigned)
+	}
+
+	// A task assigned while Ana is deleted either makes it in first and
+	// keeps her, or is refused because she is gone
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		taskManager.Create(ctx, Task{Title: "Order bins", Owner: "Ana", Type: categories.Name(CategoryOngoing), Priority: "Medium"})
+	}()
+	go func() {
+		defer wg.Done()
+		taskManager.DeletePerson(ana.ID)
+	}()
+	wg.Wait()
+	_, err := people.Get(ana.ID)
+	for _, task := range taskManager.List() {
+		if task.HasOwner(ana.ID) && err != nil {
+			t.Errorf("task %d is assigned to Ana, who was deleted", task.ID)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Role decides what an account may do.
+type Role string
+
+// Account roles
+const (
+	RoleAdmin  Role = "admin"  // may do everything
+	RoleMember Role = "member" // may add tasks, work on their own tasks and comment
+	RoleViewer Role = "viewer" // may only read
+)
+
+// roles lists every role, most powerful first.
+var roles = []Role{RoleAdmin, RoleMember, RoleViewer}
+
+// Permission names an operation that a role may or may not perform.
+type Permission string
+
+// Permissions checked by the API
+const (
+	PermCreateTask     Permission = "create_task"
+	PermEditTask       Permission = "edit_task"     // change any field of any task
+	PermEditOwnTask    Permission = "edit_own_task" // change ownerEditableFields of tasks you own
+	PermDeleteTask     Permission = "delete_task"
+	PermComment        Permission = "comment"
+	PermManagePeople   Permission = "manage_people"
+	PermManageAccounts Permission = "manage_accounts"
+
+	PermManageCategories Permission = "manage_categories"
+	PermManageWorkflow   Permission = "manage_workflow"
+	PermManageWebhooks   Permission = "manage_webhooks"
+
+	PermManageIntegrations Permission = "manage_integrations"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermCreateTask, PermEditTask, PermEditOwnTask, PermDeleteTask,
+		PermComment, PermManagePeople, PermManageAccounts, PermManageCategories,
+		PermManageWorkflow, PermManageWebhooks, PermManageIntegrations,
+	},
+	RoleMember: {PermCreateTask, PermEditOwnTask, PermComment},
+	RoleViewer: {},
+}
+
+// ownerEditableFields are the task fields, as named by diffTasks, that an
+// owner without PermEditTask may change on their own tasks.
+var ownerEditableFields = []string{"notes", "completed", "checklist", "workflow_status"}
+
+// ErrForbidden is returned when an account lacks the permission for a change.
+var ErrForbidden = errors.New("you do not have permission to do that")
+
+// Can reports whether the role grants p.
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// Permissions lists what the role grants.
+func (r Role) Permissions() []Permission {
+	return append([]Permission{}, rolePermissions[r]...)
+}
+
+// canWorkOn reports whether account may change task in some way: admins may
+// change any task, members only those they own.
+func canWorkOn(account Account, task Task) bool {
+	return account.Role.Can(PermEditTask) ||
+		(account.Role.Can(PermEditOwnTask) && task.HasOwner(account.PersonID))
+}
+
+// authorizeTaskChange checks each field changed between before and after
+// against the account in ctx. Changes made without an account, such as
+// seeding, are allowed.
+func authorizeTaskChange(ctx context.Context, before, after *Task) error {
+	account, ok := accountFrom(ctx)
+	if !ok || account.Role.Can(PermEditTask) {
+		return nil
+	}
+	if !canWorkOn(account, *before) {
+		return ErrForbidden
+	}
+	var denied []string
+	for _, change := range diffTasks(before, after) {
+		if !slices.Contains(ownerEditableFields, change.Field) {
+			denied = append(denied, change.Field)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: only an admin can change %s", ErrForbidden, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// requirePermission sends a 403 and returns false unless the signed-in
+// account has p.
+func requirePermission(w http.ResponseWriter, r *http.Request, p Permission) bool {
+	if account, ok := accountFrom(r.Context()); ok && account.Role.Can(p) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, ErrForbidden.Error())
+	return false
+}
+
+// requireTaskAccess sends a 403 and returns false unless the signed-in
+// account may work on the task.
+func requireTaskAccess(w http.ResponseWriter, r *http.Request, taskID int) bool {
+	task, err := taskManager.Get(taskID)
+	if err != nil {
+		writeTaskError(w, err)
+		return false
+	}
+	if account, ok := accountFrom(r.Context()); ok && canWorkOn(account, task) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, ErrForbidden.Error())
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestPermissionMatrix(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	clients := map[string]*testClient{}
+	for username, role := range map[string]Role{"ada": RoleAdmin, "mia": RoleMember, "vic": RoleViewer} {
+		addAccount(t, username, role)
+		clients[username] = signedIn(t, srv, username)
+	}
+
+	// Each request is made against two new tasks, one owned by mia and one by ada
+	type request struct {
+		method, path string
+		body         any
+	}
+	edit := func(ofOther bool, change func(*Task)) func(own, other Task) request {
+		return func(own, other Task) request {
+			task := own
+			if ofOther {
+				task = other
+			}
+			change(&task)
+			return request{"PUT", fmt.Sprintf("/api/tasks/%d", task.ID), task}
+		}
+	}
+	notes := func(task *Task) { task.Notes = "Ordered" }
+	title := func(task *Task) { task.Title = "Renamed" }
+	on := func(ofOther bool, method, sub string, body any) func(own, other Task) request {
+		return func(own, other Task) request {
+			task := own
+			if ofOther {
+				task = other
+			}
+			return request{method, fmt.Sprintf("/api/tasks/%d%s", task.ID, sub), body}
+		}
+	}
+	fixed := func(method, path string, body any) func(own, other Task) request {
+		return func(Task, Task) request { return request{method, path, body} }
+	}
+	newTask := map[string]string{"title": "Order bins", "type": categories.Name(CategoryOngoing), "priority": "Medium"}
+	subtask := map[string]string{"title": "Buy hinges"}
+	newAccount := func(username string) map[string]string {
+		return map[string]string{"username": username, "password": testPassword, "name": username}
+	}
+
+	tests := []struct {
+		name    string
+		request func(own, other Task) request
+		want    map[string]int // by username
+	}{
+		{"list tasks", fixed("GET", "/api/tasks", nil), map[string]int{"ada": 200, "mia": 200, "vic": 200}},
+		{"create a task", fixed("POST", "/api/tasks", newTask), map[string]int{"ada": 200, "mia": 200, "vic": 403}},
+		{"edit own notes", edit(false, notes), map[string]int{"ada": 200, "mia": 200, "vic": 403}},
+		{"edit own title", edit(false, title), map[string]int{"ada": 200, "mia": 403, "vic": 403}},
+		{"edit another's notes", edit(true, notes), map[string]int{"ada": 200, "mia": 403, "vic": 403}},
+		{"delete a task", on(false, "DELETE", "", nil), map[string]int{"ada": 204, "mia": 403, "vic": 403}},
+		{"comment", on(true, "POST", "/comments", map[string]string{"body": "On it"}), map[string]int{"ada": 201, "mia": 201, "vic": 403}},
+		{"add a checklist item to another's task", on(true, "POST", "/checklist", map[string]string{"text": "Buy hinges"}), map[string]int{"ada": 201, "mia": 403, "vic": 403}},
+		{"add a subtask to an own task", on(false, "POST", "/subtasks", subtask), map[string]int{"ada": 201, "mia": 201, "vic": 403}},
+		{"add a subtask to another's task", on(true, "POST", "/subtasks", subtask), map[string]int{"ada": 201, "mia": 403, "vic": 403}},
+		{"add an account", nil, map[string]int{"ada": 201, "mia": 403, "vic": 403}},
+		{"add a person", fixed("POST", "/api/people", map[string]string{"name": "Bo"}), map[string]int{"ada": 201, "mia": 403, "vic": 403}},
+		{"change the workflow", fixed("PUT", "/api/workflow", map[string]any{}), map[string]int{"mia": 403, "vic": 403}},
+		{"add a webhook", fixed("POST", "/api/webhooks", map[string]any{}), map[string]int{"mia": 403, "vic": 403}},
+	}
+	for _, tt := range tests {
+		for username, want := range tt.want {
+			own := createTask(t, ctx, Task{Title: "Fix the gate", Owner: "mia"})
+			other := createTask(t, ctx, Task{Title: "Paint the fence", Owner: "ada"})
+			request := tt.request
+			if request == nil {
+				request = fixed("POST", "/api/accounts", newAccount(fmt.Sprintf("new-%s-%d", username, own.ID)))
+			}
+			req := request(own, other)
+			if got := clients[username].do(req.method, req.path, req.body, nil); got != want {
+				t.Errorf("%s as %s: %s %s = %d, want %d", tt.name, username, req.method, req.path, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPageSize caps the limit parameter of GET /api/tasks.
+	maxPageSize = 500
+)
+
+// taskSortKeys are the fields GET /api/tasks can sort by. A leading "-"
+// on the sort parameter reverses the order. Ascending priority runs Low to
+// High, so "-priority" lists urgent work first.
+var taskSortKeys = map[string]func(a, b TaskView) int{
+	"id":         func(a, b TaskView) int { return a.ID - b.ID },
+	"title":      func(a, b TaskView) int { return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) },
+	"type":       func(a, b TaskView) int { return strings.Compare(a.Type, b.Type) },
+	"owner":      func(a, b TaskView) int { return strings.Compare(strings.ToLower(a.Owner), strings.ToLower(b.Owner)) },
+	"priority":   func(a, b TaskView) int { return priorityRank(b.Priority) - priorityRank(a.Priority) },
+	"created_at": func(a, b TaskView) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"due_at":     func(a, b TaskView) int { return compareOptionalTime(a.DueAt, b.DueAt) },
+	"position":   func(a, b TaskView) int { return compareBoardPlace(a.Task, b.Task) },
+}
+
+// TaskQuery is a parsed set of filters, ordering and paging for the task list.
+type TaskQuery struct {
+	Types      []string
+	Statuses   []string
+	Workflow   []string // workflow status IDs
+	Owners     []PersonID
+	Priorities []string
+	Terms      []string
+	DueBefore  *time.Time
+	Overdue    *bool
+	Parent     *int // 0 matches top-level tasks only
+	Residents  []string
+
+	Sort       string
+	Descending bool
+
+	Offset int
+	Limit  int // 0 means no limit
+}
+
+// parseTaskQuery reads filters from URL query parameters. Repeated
+// parameters (or comma-separated status and priority values) match any
+// of the given values.
+func parseTaskQuery(values url.Values) (TaskQuery, error) {
+	q := TaskQuery{
+		Types:      values["type"],
+		Statuses:   splitValues(values["status"]),
+		Workflow:   splitValues(values["workflow_status"]),
+		Priorities: splitValues(values["priority"]),
+		Residents:  values["resident"],
+		Terms:      strings.Fields(strings.ToLower(values.Get("q"))),
+		Sort:       "id",
+	}
+
+	for _, s := range q.Statuses {
+		if !slices.Contains([]string{"pending", "completed", "overdue", "due_soon", "blocked"}, s) {
+			return q, fmt.Errorf("unknown status %q", s)
+		}
+	}
+	for i, p := range q.Priorities {
+		rank := priorityRank(p)
+		if rank == len(taskPriorities) {
+			return q, fmt.Errorf("unknown priority %q", p)
+		}
+		q.Priorities[i] = taskPriorities[rank]
+	}
+
+	for _, value := range values["owner"] {
+		p, ok := people.Lookup(value)
+		if !ok {
+			// Nobody by that name owns anything, so nothing can match.
+			p.ID = PersonID("\x00" + value)
+		}
+		q.Owners = append(q.Owners, p.ID)
+	}
+
+	if value := values.Get("due_before"); value != "" {
+		t, err := parseDueTime(value)
+		if err != nil {
+			return q, errors.New("invalid due_before date")
+		}
+		q.DueBefore = &t
+	}
+	if value := values.Get("overdue"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, errors.New("invalid overdue flag")
+		}
+		q.Overdue = &b
+	}
+
+	if value := values.Get("parent"); value != "" {
+		parent := 0
+		if value != "none" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return q, errors.New(`parent must be a task ID or "none"`)
+			}
+			parent = n
+		}
+		q.Parent = &parent
+	}
+
+	if value := values.Get("sort"); value != "" {
+		q.Sort, q.Descending = strings.CutPrefix(value, "-")
+		if _, ok := taskSortKeys[q.Sort]; !ok {
+			return q, fmt.Errorf("cannot sort by %q", q.Sort)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = n
+	}
+	if value := values.Get("cursor"); value != "" {
+		offset, err := decodeCursor(value)
+		if err != nil {
+			return q, errors.New("invalid cursor")
+		}
+		q.Offset = offset
+	}
+	return q, nil
+}
+
+// resolveOwnerMe replaces owner=me in params with the signed-in account's
+// person, reporting whether it did.
+func resolveOwnerMe(ctx context.Context, params url.Values) bool {
+	account, ok := accountFrom(ctx)
+	if !ok || account.PersonID == "" {
+		return false
+	}
+	found := false
+	for i, owner := range params["owner"] {
+		if owner == "me" {
+			params["owner"][i] = string(account.PersonID)
+			found = true
+		}
+	}
+	return found
+}
+
+// Match reports whether a task passes every filter in the query.
+func (q TaskQuery) Match(v TaskView) bool {
+	if len(q.Types) > 0 && !slices.Contains(q.Types, v.Type) {
+		return false
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, v.Priority) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.ContainsFunc(q.Statuses, func(s string) bool { return hasStatus(v, s) }) {
+		return false
+	}
+	if len(q.Workflow) > 0 && !slices.Contains(q.Workflow, v.WorkflowStatus) {
+		return false
+	}
+	if len(q.Owners) > 0 && !slices.ContainsFunc(q.Owners, v.HasOwner) {
+		return false
+	}
+	if q.DueBefore != nil && (v.DueAt == nil || !v.DueAt.Before(*q.DueBefore)) {
+		return false
+	}
+	if q.Overdue != nil && v.Overdue != *q.Overdue {
+		return false
+	}
+	if q.Parent != nil && v.ParentID != *q.Parent {
+		return false
+	}
+	if len(q.Residents) > 0 && !slices.Contains(q.Residents, v.ResidentID) {
+		return false
+	}
+	if len(q.Terms) > 0 {
+		text := strings.ToLower(v.Title + "\n" + v.Notes)
+		for _, term := range q.Terms {
+			if !strings.Contains(text, term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply filters and sorts tasks, then returns the requested page and the
+// cursor for the next one ("" on the last page).
+func (q TaskQuery) Apply(tasks []TaskView) (page []TaskView, total int, next string) {
+	matched := []TaskView{}
+	for _, v := range tasks {
+		if q.Match(v) {
+			matched = append(matched, v)
+		}
+	}
+
+	compare := taskSortKeys[q.Sort]
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compare(matched[i], matched[j])
+		if c == 0 {
+			c = matched[i].ID - matched[j].ID
+		}
+		if q.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total = len(matched)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 && start+q.Limit < total {
+		end = start + q.Limit
+		next = encodeCursor(end)
+	}
+	return matched[start:end], total, next
+}
+
+// hasStatus reports whether a task is in the named status.
+func hasStatus(v TaskView, status string) bool {
+	switch status {
+	case "pending":
+		return !v.Completed
+	case "completed":
+		return v.Completed
+	case "overdue":
+		return v.Overdue
+	case "due_soon":
+		return v.DueSoon
+	case "blocked":
+		return v.Blocked
+	}
+	return false
+}
+
+// priorityRank orders priorities from High (0) down; unknown values sort last.
+func priorityRank(priority string) int {
+	for i, p := range taskPriorities {
+		if strings.EqualFold(p, priority) {
+			return i
+		}
+	}
+	return len(taskPriorities)
+}
+
+// compareBoardPlace orders tasks as they appear on the board: by column,
+// then from the top of each column.
+func compareBoardPlace(a, b Task) int {
+	statuses := workflow.Statuses()
+	column := func(t Task) int {
+		return slices.IndexFunc(statuses, func(s WorkflowStatus) bool { return s.ID == t.WorkflowStatus })
+	}
+	if c := column(a) - column(b); c != 0 {
+		return c
+	}
+	return a.Position - b.Position
+}
+
+// compareOptionalTime orders missing times after present ones.
+func compareOptionalTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return a.Compare(*b)
+}
+
+func splitValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// Cursors are opaque to clients; they currently encode a result offset.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, ok := strings.CutPrefix(string(data), "o:")
+	if !ok {
+		return 0, errors.New("malformed cursor")
+	}
+	n, err := strconv.Atoi(offset)
+	if err != nil || n < 0 {
+		return 0, errors.New("malformed cursor")
+	}
+	return n, nil
+}
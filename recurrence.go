@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// rruleWeekdays maps RRULE day codes to weekdays.
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRule is the subset of an iCalendar RRULE that tasks can repeat on:
+// FREQ=DAILY|WEEKLY|MONTHLY with optional INTERVAL, BYDAY (daily and weekly
+// only), and UNTIL or COUNT. For example "FREQ=WEEKLY;BYDAY=WE" repeats
+// every Wednesday.
+type RRule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Until    *time.Time
+	Count    int // total number of occurrences, including the first
+}
+
+// parseRRule reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH".
+// A leading "RRULE:" is ignored.
+func parseRRule(s string) (RRule, error) {
+	rule := RRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return RRule{}, fmt.Errorf("%q is not KEY=VALUE", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if rule.Freq != FreqDaily && rule.Freq != FreqWeekly && rule.Freq != FreqMonthly {
+				return RRule{}, errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return RRule{}, errors.New("INTERVAL must be a positive number")
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(strings.ToUpper(value), ",") {
+				day, ok := rruleWeekdays[code]
+				if !ok {
+					return RRule{}, fmt.Errorf("unknown BYDAY value %q", code)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return RRule{}, errors.New("UNTIL must be a date such as 20250131 or 20250131T120000Z")
+			}
+			rule.Until = &until
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return RRule{}, errors.New("COUNT must be a positive number")
+			}
+			rule.Count = n
+		default:
+			return RRule{}, fmt.Errorf("%s is not supported", strings.ToUpper(key))
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return RRule{}, errors.New("FREQ is required")
+	case rule.Until != nil && rule.Count > 0:
+		return RRule{}, errors.New("UNTIL and COUNT cannot both be set")
+	case rule.Freq == FreqMonthly && len(rule.ByDay) > 0:
+		return RRule{}, errors.New("BYDAY is only supported with DAILY or WEEKLY")
+	case rule.Freq == FreqDaily && len(rule.ByDay) > 0 && rule.Interval%7 == 0:
+		return RRule{}, errors.New("BYDAY cannot be used with a DAILY INTERVAL that is a multiple of 7; use FREQ=WEEKLY")
+	}
+	return rule, nil
+}
+
+// parseRRuleTime reads an RRULE date (20250131) or UTC time (20250131T120000Z).
+// A date means the end of that day, so the last occurrence is included.
+func parseRRuleTime(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("20060102", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.Add(24*time.Hour - time.Second), nil
+}
+
+// Next returns the first occurrence after prev, which was occurrence number
+// n of the series. It reports false once the series is over.
+func (r RRule) Next(prev time.Time, n int) (time.Time, bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	switch r.Freq {
+	case FreqDaily:
+		// Seven steps of INTERVAL days reach every weekday the rule can
+		// land on; a multiple of 7 only ever reaches prev's weekday.
+		next = prev.AddDate(0, 0, r.Interval)
+		for steps := 1; len(r.ByDay) > 0 && !slices.Contains(r.ByDay, next.Weekday()); steps++ {
+			if steps == 7 {
+				return time.Time{}, false
+			}
+			next = next.AddDate(0, 0, r.Interval)
+		}
+
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			next = prev.AddDate(0, 0, 7*r.Interval)
+			break
+		}
+		// Try the remaining days of this week, then the days of every
+		// INTERVAL-th week after it.
+		week := startOfWeek(prev)
+		for next = prev.AddDate(0, 0, 1); ; next = next.AddDate(0, 0, 1) {
+			weeks := int(startOfWeek(next).Sub(week).Hours()/24+0.5) / 7
+			if weeks%r.Interval == 0 && slices.Contains(r.ByDay, next.Weekday()) {
+				break
+			}
+		}
+
+	case FreqMonthly:
+		// Months without the day of the month, such as 31 February, are
+		// skipped rather than moved.
+		for months := r.Interval; ; months += r.Interval {
+			next = time.Date(prev.Year(), prev.Month()+time.Month(months), prev.Day(),
+				prev.Hour(), prev.Minute(), prev.Second(), prev.Nanosecond(), prev.Location())
+			if next.Day() == prev.Day() {
+				break
+			}
+		}
+	}
+
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// startOfWeek returns midnight on the Monday of t's week.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+// nextOccurrence returns the task that follows a completed occurrence of a
+// recurring task, with a fresh creation time and due date. It reports
+// false if the task does not recur or its series is over.
+func nextOccurrence(task Task, now time.Time) (Task, bool) {
+	if task.Recurrence == "" {
+		return Task{}, false
+	}
+	rule, err := parseRRule(task.Recurrence)
+	if err != nil {
+		return Task{}, false
+	}
+	prev := task.CreatedAt
+	if task.DueAt != nil {
+		prev = *task.DueAt
+	}
+	occurrence := max(task.Occurrence, 1)
+	due, ok := rule.Next(prev, occurrence)
+	if !ok {
+		return Task{}, false
+	}
+	// A series that fell behind catches up rather than creating a task
+	// that is already overdue.
+	for due.Before(now) {
+		occurrence++
+		if due, ok = rule.Next(due, occurrence); !ok {
+			return Task{}, false
+		}
+	}
+
+	next := task
+	next.Completed = false
+	next.CompletedAt = nil
+	next.CreatedAt = now
+	next.DueAt = &due
+	next.SeriesID = task.SeriesID
+	if next.SeriesID == 0 {
+		next.SeriesID = task.ID
+	}
+	next.Occurrence = occurrence + 1
+	next.NextOccurrence = 0
+	next.BlockedBy = nil // blockers belong to the occurrence that waited on them
+	next.Version = 1
+	return next, true
+}
+
+// describeRRule returns a short English description of a valid rule, such
+// as "every 2 weeks on Mon, Thu until 31 Jan 2025".
+func describeRRule(s string) string {
+	rule, err := parseRRule(s)
+	if err != nil {
+		return ""
+	}
+	unit := map[string]string{FreqDaily: "day", FreqWeekly: "week", FreqMonthly: "month"}[rule.Freq]
+	text := "every " + unit
+	if rule.Interval > 1 {
+		text = fmt.Sprintf("every %d %ss", rule.Interval, unit)
+	}
+	if len(rule.ByDay) > 0 {
+		days := make([]string, len(rule.ByDay))
+		for i, d := range rule.ByDay {
+			days[i] = d.String()[:3]
+		}
+		text += " on " + strings.Join(days, ", ")
+	}
+	switch {
+	case rule.Until != nil:
+		text += " until " + rule.Until.Format("2 Jan 2006")
+	case rule.Count > 0:
+		text += fmt.Sprintf(", %d times", rule.Count)
+	}
+	return text
+}
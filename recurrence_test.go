@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRuleRejectsUnreachableByDay(t *testing.T) {
+	for _, s := range []string{"FREQ=DAILY;INTERVAL=7;BYDAY=TU", "FREQ=DAILY;INTERVAL=14;BYDAY=MO,WE"} {
+		if _, err := parseRRule(s); err == nil {
+			t.Errorf("parseRRule(%q) accepted a rule that can only land on one weekday", s)
+		}
+	}
+	if _, err := parseRRule("FREQ=DAILY;INTERVAL=3;BYDAY=TU"); err != nil {
+		t.Errorf("parseRRule rejected a reachable BYDAY: %v", err)
+	}
+}
+
+func TestNextDailyByDayEnds(t *testing.T) {
+	monday := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule   RRule
+		want   time.Time
+		wantOK bool
+	}{
+		// Built directly, as a rule stored before parseRRule rejected it would be
+		{RRule{Freq: FreqDaily, Interval: 7, ByDay: []time.Weekday{time.Tuesday}}, time.Time{}, false},
+		{RRule{Freq: FreqDaily, Interval: 7, ByDay: []time.Weekday{time.Monday}}, monday.AddDate(0, 0, 7), true},
+		{RRule{Freq: FreqDaily, Interval: 3, ByDay: []time.Weekday{time.Tuesday}}, monday.AddDate(0, 0, 15), true},
+		{RRule{Freq: FreqDaily, Interval: 1, ByDay: []time.Weekday{time.Friday}}, monday.AddDate(0, 0, 4), true},
+	}
+	for _, tt := range tests {
+		done := make(chan struct{})
+		var got time.Time
+		var ok bool
+		go func() {
+			got, ok = tt.rule.Next(monday, 1)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Next(%+v) did not return", tt.rule)
+		}
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("Next(%+v) = %v, %v; want %v, %v", tt.rule, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resident is someone living, or who has lived, at the property, as
+// pulled from Zoho CRM. Residents are never deleted locally so tasks
+// stay linked to them; records gone from Zoho are marked Removed.
+type Resident struct {
+	ID      string `json:"id"` // Zoho record ID
+	Name    string `json:"name"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Unit    string `json:"unit,omitempty"`
+	Status  string `json:"status,omitempty"`
+	MoveIn  string `json:"move_in,omitempty"`  // YYYY-MM-DD
+	MoveOut string `json:"move_out,omitempty"` // YYYY-MM-DD, when the residency ends or ended
+
+	// Current is worked out when residents are read, from Status or, if
+	// Zoho has none, from MoveOut.
+	Current    bool      `json:"current"`
+	Removed    bool      `json:"removed,omitempty"`
+	ModifiedAt time.Time `json:"modified_at"` // in Zoho
+	SyncedAt   time.Time `json:"synced_at"`
+}
+
+// ErrResidentNotFound is returned when no resident has the requested ID.
+var ErrResidentNotFound = errors.New("resident not found")
+
+// ResidentRegistry holds the residents pulled from Zoho CRM and the
+// settings of the sync.
+type ResidentRegistry struct {
+	mu        sync.RWMutex
+	store     Store
+	residents []Resident
+	zoho      zohoState
+	client    *ZohoClient
+
+	// syncing lets one sync run at a time
+	syncing sync.Mutex
+}
+
+// residents holds the resident records synced from Zoho
+var residents *ResidentRegistry
+
+// NewResidentRegistry loads residents and the Zoho settings from store.
+func NewResidentRegistry(store Store) (*ResidentRegistry, error) {
+	list := []Resident{}
+	if _, err := store.Load("residents", &list); err != nil {
+		return nil, err
+	}
+	zoho := zohoState{Config: defaultZohoConfig()}
+	if _, err := store.Load("zoho", &zoho); err != nil {
+		return nil, err
+	}
+	r := &ResidentRegistry{store: store, residents: list, zoho: zoho}
+	r.client = zoho.Config.client()
+	return r, nil
+}
+
+// isCurrent reports whether a resident still lives at the property on the
+// given day (YYYY-MM-DD). Callers must hold r.mu.
+func (r *ResidentRegistry) isCurrent(res Resident, today string) bool {
+	if res.Removed {
+		return false
+	}
+	if statuses := r.zoho.Config.CurrentStatuses; res.Status != "" && len(statuses) > 0 {
+		return slices.ContainsFunc(statuses, func(s string) bool { return strings.EqualFold(s, res.Status) })
+	}
+	return res.MoveOut == "" || res.MoveOut > today
+}
+
+// List returns every resident, sorted by name.
+func (r *ResidentRegistry) List() []Resident {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	today := time.Now().Format("2006-01-02")
+	list := slices.Clone(r.residents)
+	for i := range list {
+		list[i].Current = r.isCurrent(list[i], today)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list
+}
+
+// Get returns the resident with the given Zoho record ID.
+func (r *ResidentRegistry) Get(id string) (Resident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, res := range r.residents {
+		if res.ID == id {
+			res.Current = r.isCurrent(res, time.Now().Format("2006-01-02"))
+			return res, nil
+		}
+	}
+	return Resident{}, ErrResidentNotFound
+}
+
+// Name returns a resident's name, or "" if there is no such resident.
+func (r *ResidentRegistry) Name(id string) string {
+	if id == "" {
+		return ""
+	}
+	res, err := r.Get(id)
+	if err != nil {
+		return ""
+	}
+	return res.Name
+}
+
+// checkResident rejects linking a task to a resident who is not in the
+// registry. Links that are already set may stay.
+func checkResident(before *Task, task Task) error {
+	if task.ResidentID == "" || (before != nil && before.ResidentID == task.ResidentID) {
+		return nil
+	}
+	if _, err := residents.Get(task.ResidentID); err != nil {
+		return &ValidationError{Fields: []FieldError{{Field: "resident_id", Message: "unknown resident"}}}
+	}
+	return nil
+}
+
+// matchResident reports whether a resident is in the given status (current,
+// former or removed; "" matches everyone not removed) and their name, email,
+// unit or phone contain every term.
+func matchResident(res Resident, status string, terms []string) bool {
+	switch status {
+	case "":
+		if res.Removed {
+			return false
+		}
+	case "current":
+		if !res.Current {
+			return false
+		}
+	case "former":
+		if res.Current || res.Removed {
+			return false
+		}
+	case "removed":
+		if !res.Removed {
+			return false
+		}
+	}
+	text := strings.ToLower(strings.Join([]string{res.Name, res.Email, res.Unit, res.Phone}, "\n"))
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// residentsHandler serves GET /api/residents, filtered by status (current,
+// former or removed) and q, and GET /api/residents/{id}, which also lists
+// the tasks linked to the resident. Residents are edited in Zoho, not here.
+func residentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/residents"), "/")
+	if id == "" {
+		status := r.URL.Query().Get("status")
+		if !slices.Contains([]string{"", "current", "former", "removed"}, status) {
+			writeError(w, http.StatusBadRequest, `status must be "current", "former" or "removed"`)
+			return
+		}
+		terms := strings.Fields(strings.ToLower(r.URL.Query().Get("q")))
+		list := []Resident{}
+		for _, res := range residents.List() {
+			if matchResident(res, status, terms) {
+				list = append(list, res)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	res, err := residents.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	tasks := []int{}
+	for _, task := range taskManager.List() {
+		if task.ResidentID == id {
+			tasks = append(tasks, task.ID)
+		}
+	}
+	json.NewEncoder(w).Encode(struct {
+		Resident
+		Tasks []int `json:"tasks"`
+	}{res, tasks})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// seedFile is the layout of a seed file. A bare JSON array of tasks is
+// accepted as well.
+type seedFile struct {
+	Tasks []json.RawMessage `json:"tasks"`
+}
+
+// SeedRejection explains why an entry in a seed file was skipped.
+type SeedRejection struct {
+	Index  int    // position of the entry in the file, starting at 1
+	Title  string // title of the entry, if it could be read
+	Reason string
+}
+
+func (r SeedRejection) String() string {
+	if r.Title == "" {
+		return fmt.Sprintf("entry %d: %s", r.Index, r.Reason)
+	}
+	return fmt.Sprintf("entry %d (%q): %s", r.Index, r.Title, r.Reason)
+}
+
+// loadSeedFile reads tasks from a JSON seed file. Entries that do not match
+// the Task schema are skipped and reported; the returned NextID is one past
+// the highest ID in use.
+func loadSeedFile(path string) ([]Task, int, []SeedRejection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var entries []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &entries)
+	} else {
+		var file seedFile
+		err = json.Unmarshal(data, &file)
+		entries = file.Tasks
+	}
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var (
+		tasks    []Task
+		rejected []SeedRejection
+		usedIDs  = map[int]bool{}
+		now      = time.Now()
+	)
+	for i, raw := range entries {
+		var task Task
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&task); err != nil {
+			rejected = append(rejected, SeedRejection{Index: i + 1, Reason: err.Error()})
+			continue
+		}
+		if reason := checkSeedTask(task, usedIDs); reason != "" {
+			rejected = append(rejected, SeedRejection{Index: i + 1, Title: task.Title, Reason: reason})
+			continue
+		}
+
+		if task.ID != 0 {
+			usedIDs[task.ID] = true
+		}
+		if task.CreatedAt.IsZero() {
+			task.CreatedAt = now
+		}
+		if task.Completed && task.CompletedAt == nil {
+			completedAt := task.CreatedAt
+			task.CompletedAt = &completedAt
+		} else if !task.Completed {
+			task.CompletedAt = nil
+		}
+		tasks = append(tasks, task)
+	}
+
+	// Entries without an ID are numbered after the highest explicit one.
+	nextID := 1
+	for id := range usedIDs {
+		nextID = max(nextID, id+1)
+	}
+	for i := range tasks {
+		if tasks[i].ID == 0 {
+			tasks[i].ID = nextID
+			nextID++
+		}
+	}
+	return tasks, nextID, rejected, nil
+}
+
+// checkSeedTask returns why a seed entry is invalid, or "" if it is fine.
+func checkSeedTask(task Task, usedIDs map[int]bool) string {
+	switch {
+	case task.ID < 0:
+		return "id must be positive"
+	case usedIDs[task.ID]:
+		return fmt.Sprintf("duplicate id %d", task.ID)
+	}
+	if err := validateTask(task); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Store persists named collections of application data between restarts.
+// Each collection is saved and loaded as a whole.
+type Store interface {
+	// Load decodes the named collection into v. It reports false when
+	// the collection has never been saved.
+	Load(collection string, v any) (bool, error)
+	// Save replaces the named collection with v.
+	Save(collection string, v any) error
+	Close() error
+}
+
+// openStore opens the storage backend selected on the command line.
+func openStore(kind, path string) (Store, error) {
+	switch kind {
+	case "json":
+		return NewJSONStore(path)
+	case "sqlite":
+		return NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store %q (want json or sqlite)", kind)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONStore keeps each collection in its own JSON file inside a directory.
+// Files are written to a temporary file and renamed into place so a crash
+// never leaves a half-written collection behind.
+type JSONStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewJSONStore opens (creating if needed) a JSON store rooted at dir.
+func NewJSONStore(dir string) (*JSONStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &JSONStore{dir: dir}, nil
+}
+
+func (s *JSONStore) file(collection string) string {
+	return filepath.Join(s.dir, collection+".json")
+}
+
+// Load reads a collection file into v.
+func (s *JSONStore) Load(collection string, v any) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.file(collection))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Save atomically replaces a collection file with v.
+func (s *JSONStore) Save(collection string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, collection+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file(collection))
+}
+
+// Close is a no-op; every Save is already flushed to disk.
+func (s *JSONStore) Close() error {
+	return nil
+}
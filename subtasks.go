@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxChecklistItemLength limits the text of a checklist item, in characters.
+const maxChecklistItemLength = 500
+
+var (
+	// ErrChecklistItemNotFound is returned when a task has no checklist item
+	// with the requested ID.
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
+	// ErrHasSubtasks is returned when deleting a task that still has subtasks.
+	ErrHasSubtasks = errors.New("task still has subtasks")
+)
+
+// ChecklistItem is one step of a task.
+type ChecklistItem struct {
+	ID     int        `json:"id"`
+	Text   string     `json:"text"`
+	Done   bool       `json:"done"`
+	DoneAt *time.Time `json:"done_at,omitempty"`
+}
+
+// Progress counts the finished checklist items and subtasks of a task.
+type Progress struct {
+	Done     int     `json:"done"`
+	Total    int     `json:"total"`
+	Fraction float64 `json:"fraction"`
+}
+
+// taskProgress returns the progress of a task with the given subtasks, or
+// nil if it has neither checklist items nor subtasks.
+func taskProgress(task Task, children []Task) *Progress {
+	p := Progress{Total: len(task.Checklist) + len(children)}
+	if p.Total == 0 {
+		return nil
+	}
+	for _, item := range task.Checklist {
+		if item.Done {
+			p.Done++
+		}
+	}
+	for _, child := range children {
+		if child.Completed {
+			p.Done++
+		}
+	}
+	p.Fraction = float64(p.Done) / float64(p.Total)
+	return &p
+}
+
+// numberChecklist gives IDs to new checklist items and stamps DoneAt,
+// keeping the IDs and times of items that were already in before.
+func numberChecklist(items []ChecklistItem, before []ChecklistItem, now time.Time) []ChecklistItem {
+	nextID := 1
+	for _, item := range append(slices.Clone(before), items...) {
+		nextID = max(nextID, item.ID+1)
+	}
+	numbered := make([]ChecklistItem, len(items))
+	for i, item := range items {
+		item.Text = strings.TrimSpace(item.Text)
+		if item.ID == 0 {
+			item.ID = nextID
+			nextID++
+		}
+		old := slices.IndexFunc(before, func(b ChecklistItem) bool { return b.ID == item.ID })
+		switch {
+		case !item.Done:
+			item.DoneAt = nil
+		case old >= 0 && before[old].Done:
+			item.DoneAt = before[old].DoneAt
+		default:
+			item.DoneAt = &now
+		}
+		numbered[i] = item
+	}
+	return numbered
+}
+
+// Children returns the subtasks of a task.
+func (m *TaskManager) Children(id int) []Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return childrenOf(m.tasks, id)
+}
+
+func childrenOf(tasks []Task, id int) []Task {
+	children := []Task{}
+	for _, t := range tasks {
+		if t.ParentID == id {
+			children = append(children, t)
+		}
+	}
+	return children
+}
+
+// checkParent makes sure a task's parent exists and that following parents
+// up from it never comes back to the task.
+// Callers must hold m.mu.
+func (m *TaskManager) checkParent(task Task) error {
+	for parentID, seen := task.ParentID, 0; parentID != 0; seen++ {
+		if parentID == task.ID || seen > len(m.tasks) {
+			return &ValidationError{Fields: []FieldError{{Field: "parent_id", Message: "would make the task a subtask of itself"}}}
+		}
+		i := m.index(parentID)
+		if i < 0 {
+			return &ValidationError{Fields: []FieldError{{Field: "parent_id", Message: "no task with ID " + strconv.Itoa(parentID)}}}
+		}
+		parentID = m.tasks[i].ParentID
+	}
+	return nil
+}
+
+// completeParents marks the ancestors of a task complete when they ask to
+// be auto-completed and every checklist item and subtask of theirs is
+// done, unless they are blocked. It returns the before and after of each
+// task it completed.
+func completeParents(tasks []Task, id int, now time.Time) (completed [][2]Task) {
+	for {
+		child := slices.IndexFunc(tasks, func(t Task) bool { return t.ID == id })
+		if child < 0 || tasks[child].ParentID == 0 {
+			return completed
+		}
+		i := slices.IndexFunc(tasks, func(t Task) bool { return t.ID == tasks[child].ParentID })
+		if i < 0 {
+			return completed
+		}
+		parent := tasks[i]
+		p := taskProgress(parent, childrenOf(tasks, parent.ID))
+		if !parent.AutoComplete || parent.Completed || p == nil || p.Done < p.Total || len(openBlockers(tasks, parent)) > 0 {
+			return completed
+		}
+		before := parent
+		parent.Completed = true
+		parent.CompletedAt = &now
+		settleStatus(tasks, &before, &parent)
+		parent.Version++
+		tasks[i] = parent
+		completed = append(completed, [2]Task{before, parent})
+		id = parent.ID
+	}
+}
+
+// modify applies fn to a copy of a task and saves the result as a new
+// version, then auto-completes its parents if needed.
+func (m *TaskManager) modify(ctx context.Context, id int, fn func(task *Task) error) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return Task{}, ErrTaskNotFound
+	}
+	current := m.tasks[i]
+	task := current
+	task.Checklist = slices.Clone(current.Checklist)
+	if err := fn(&task); err != nil {
+		return Task{}, err
+	}
+	task.Version++
+	if err := authorizeTaskChange(ctx, &current, &task); err != nil {
+		return Task{}, err
+	}
+
+	now := time.Now()
+	if task.AutoComplete && !task.Completed && len(openBlockers(m.tasks, task)) == 0 {
+		if p := taskProgress(task, childrenOf(m.tasks, id)); p != nil && p.Done == p.Total {
+			task.Completed = true
+			task.CompletedAt = &now
+			settleStatus(m.tasks, &current, &task)
+		}
+	}
+	tasks := append([]Task{}, m.tasks...)
+	tasks, nextID, next := m.scheduleNext(&task, tasks, m.nextID)
+	tasks[i] = task
+	parents := completeParents(tasks, id, now)
+	if err := m.commit(tasks, nextID); err != nil {
+		return Task{}, err
+	}
+	m.emit(ctx, ActionUpdated, &current, &task)
+	if next != nil {
+		m.emit(ctx, ActionCreated, nil, next)
+	}
+	for _, p := range parents {
+		m.emit(ctx, ActionToggled, &p[0], &p[1])
+	}
+	return task, nil
+}
+
+// AddChecklistItem appends an item to a task's checklist.
+func (m *TaskManager) AddChecklistItem(ctx context.Context, taskID int, text string) (Task, error) {
+	if err := validateChecklistItem(text); err != nil {
+		return Task{}, err
+	}
+	return m.modify(ctx, taskID, func(task *Task) error {
+		task.Checklist = numberChecklist(append(task.Checklist, ChecklistItem{Text: text}), task.Checklist, time.Now())
+		return nil
+	})
+}
+
+// UpdateChecklistItem changes the text of an item, checks it or unchecks
+// it. Nil arguments are left as they are.
+func (m *TaskManager) UpdateChecklistItem(ctx context.Context, taskID, itemID int, text *string, done *bool) (Task, error) {
+	if text != nil {
+		if err := validateChecklistItem(*text); err != nil {
+			return Task{}, err
+		}
+	}
+	return m.modify(ctx, taskID, func(task *Task) error {
+		i := slices.IndexFunc(task.Checklist, func(item ChecklistItem) bool { return item.ID == itemID })
+		if i < 0 {
+			return ErrChecklistItemNotFound
+		}
+		before := slices.Clone(task.Checklist)
+		if text != nil {
+			task.Checklist[i].Text = *text
+		}
+		if done != nil {
+			task.Checklist[i].Done = *done
+		}
+		task.Checklist = numberChecklist(task.Checklist, before, time.Now())
+		return nil
+	})
+}
+
+// DeleteChecklistItem removes an item from a task's checklist.
+func (m *TaskManager) DeleteChecklistItem(ctx context.Context, taskID, itemID int) (Task, error) {
+	return m.modify(ctx, taskID, func(task *Task) error {
+		i := slices.IndexFunc(task.Checklist, func(item ChecklistItem) bool { return item.ID == itemID })
+		if i < 0 {
+			return ErrChecklistItemNotFound
+		}
+		task.Checklist = slices.Delete(task.Checklist, i, i+1)
+		return nil
+	})
+}
+
+// ReorderChecklist puts a task's checklist items in the order of ids,
+// which must list every item exactly once.
+func (m *TaskManager) ReorderChecklist(ctx context.Context, taskID int, ids []int) (Task, error) {
+	return m.modify(ctx, taskID, func(task *Task) error {
+		if len(ids) != len(task.Checklist) {
+			return &ValidationError{Fields: []FieldError{{Field: "ids", Message: "must list every checklist item once"}}}
+		}
+		ordered := make([]ChecklistItem, 0, len(ids))
+		for _, id := range ids {
+			i := slices.IndexFunc(task.Checklist, func(item ChecklistItem) bool { return item.ID == id })
+			if i < 0 || slices.ContainsFunc(ordered, func(item ChecklistItem) bool { return item.ID == id }) {
+				return &ValidationError{Fields: []FieldError{{Field: "ids", Message: "must list every checklist item once"}}}
+			}
+			ordered = append(ordered, task.Checklist[i])
+		}
+		task.Checklist = ordered
+		return nil
+	})
+}
+
+// checklistHandler serves /api/tasks/{id}/checklist,
+// /api/tasks/{id}/checklist/order and /api/tasks/{id}/checklist/{itemID}
+func checklistHandler(w http.ResponseWriter, r *http.Request, taskID int, rest string) {
+	if !safeMethod(r.Method) && !requireTaskAccess(w, r, taskID) {
+		return
+	}
+
+	var (
+		task   Task
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case rest == "":
+		switch r.Method {
+		case "GET":
+			task, err = taskManager.Get(taskID)
+			if err == nil {
+				json.NewEncoder(w).Encode(task.Checklist)
+				return
+			}
+		case "POST":
+			var body struct {
+				Text string `json:"text"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			task, err = taskManager.AddChecklistItem(r.Context(), taskID, body.Text)
+			status = http.StatusCreated
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+			return
+		}
+
+	case rest == "order":
+		if r.Method != "PUT" {
+			methodNotAllowed(w, r, "PUT")
+			return
+		}
+		var body struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		task, err = taskManager.ReorderChecklist(r.Context(), taskID, body.IDs)
+
+	default:
+		itemID, convErr := strconv.Atoi(rest)
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, "Invalid checklist item ID")
+			return
+		}
+		switch r.Method {
+		case "PUT":
+			var body struct {
+				Text *string `json:"text"`
+				Done *bool   `json:"done"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			task, err = taskManager.UpdateChecklistItem(r.Context(), taskID, itemID, body.Text, body.Done)
+		case "DELETE":
+			task, err = taskManager.DeleteChecklistItem(r.Context(), taskID, itemID)
+		default:
+			methodNotAllowed(w, r, "PUT", "DELETE")
+			return
+		}
+	}
+
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	// Every change returns the whole task, so clients see the new
+	// progress and version.
+	setETag(w, task)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+}
+
+// subtasksHandler serves /api/tasks/{id}/subtasks. POST creates a subtask,
+// taking its type, priority and owners from the parent unless given.
+func subtasksHandler(w http.ResponseWriter, r *http.Request, taskID int) {
+	parent, err := taskManager.Get(taskID)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(viewTasks(taskManager.Children(taskID), time.Now()))
+
+	case "POST":
+		// A subtask changes its parent's progress, so it takes both
+		if !requirePermission(w, r, PermCreateTask) || !requireTaskAccess(w, r, taskID) {
+			return
+		}
+		var task Task
+		if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		task.ParentID = taskID
+		if task.Type == "" {
+			task.Type = parent.Type
+		}
+		if task.Priority == "" {
+			task.Priority = parent.Priority
+		}
+		if task.Owner == "" && len(task.Owners) == 0 {
+			task.Owners = parent.Owners
+		}
+		task, err := taskManager.Create(r.Context(), task)
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		setETag(w, task)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestChecklistChangesSetETag(t *testing.T) {
+	srv := newTestServer(t)
+	addAccount(t, "colin", RoleAdmin)
+	task := createTask(t, context.Background(), Task{Title: "Fix the gate"})
+	c := signedIn(t, srv, "colin")
+	path := fmt.Sprintf("/api/tasks/%d/checklist", task.ID)
+
+	tests := []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{"POST", path, map[string]string{"text": "Buy hinges"}, http.StatusCreated},
+		{"PUT", path + "/1", map[string]bool{"done": true}, http.StatusOK},
+		{"DELETE", path + "/1", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		var got TaskView
+		if status := c.do(tt.method, tt.path, tt.body, &got); status != tt.want {
+			t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, status, tt.want)
+		}
+		if etag := c.header.Get("ETag"); etag != strconv.Quote(strconv.Itoa(got.Version)) {
+			t.Errorf("%s %s: ETag = %q, want version %d", tt.method, tt.path, etag, got.Version)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTaskNotFound is returned when no task has the requested ID.
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrVersionConflict is returned when an update carries a stale version.
+	ErrVersionConflict = errors.New("task has been modified by someone else")
+)
+
+// TaskManager owns the task list. All access goes through its methods,
+// which serialise concurrent requests and persist every change.
+type TaskManager struct {
+	mu     sync.RWMutex
+	store  Store
+	people *PeopleRegistry
+	tasks  []Task
+	nextID int
+
+	listeners []func(TaskEvent)
+}
+
+// taskSnapshot is the persisted form of a TaskManager.
+type taskSnapshot struct {
+	Tasks  []Task `json:"tasks"`
+	NextID int    `json:"next_id"`
+}
+
+// NewTaskManager returns an empty TaskManager backed by store. Task owners
+// are resolved against people.
+func NewTaskManager(store Store, people *PeopleRegistry) *TaskManager {
+	return &TaskManager{
+		store:  store,
+		people: people,
+		tasks:  []Task{},
+		nextID: 1,
+	}
+}
+
+// Load restores tasks from the store. It reports false when nothing has
+// been saved yet.
+func (m *TaskManager) Load() (bool, error) {
+	var snap taskSnapshot
+	found, err := m.store.Load("tasks", &snap)
+	if err != nil || !found {
+		return found, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	migrated := false
+	for i := range snap.Tasks {
+		// Tasks saved before versioning start at version 1.
+		if snap.Tasks[i].Version == 0 {
+			snap.Tasks[i].Version = 1
+		}
+		deriveDueAt(&snap.Tasks[i])
+		// Tasks saved before the board start in the column that matches
+		// their completion.
+		before := snap.Tasks[i]
+		settleStatus(snap.Tasks, &before, &snap.Tasks[i])
+		// Tasks saved before the People registry only have an owner string.
+		if len(snap.Tasks[i].Owners) == 0 && snap.Tasks[i].Owner != "" {
+			if err := m.migrateOwners(&snap.Tasks[i]); err != nil {
+				return false, err
+			}
+			migrated = true
+		}
+	}
+	if snap.Tasks == nil {
+		snap.Tasks = []Task{}
+	}
+	if migrated {
+		return true, m.commit(snap.Tasks, snap.NextID)
+	}
+	m.tasks, m.nextID = snap.Tasks, snap.NextID
+	return true, nil
+}
+
+// Subscribe registers fn to be called after every change to a task. It is
+// called with the manager locked, so it must not call back into it.
+func (m *TaskManager) Subscribe(fn func(TaskEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// emit tells listeners about a change. Callers must hold m.mu.
+func (m *TaskManager) emit(ctx context.Context, action string, before, after *Task) {
+	event := TaskEvent{
+		Action: action,
+		Actor:  actorFrom(ctx),
+		At:     time.Now(),
+	}
+	if after != nil {
+		event.TaskID, event.Title = after.ID, after.Title
+		event.Changes = diffTasks(before, after)
+		task := *after
+		event.Task = &task
+	} else {
+		event.TaskID, event.Title = before.ID, before.Title
+		task := *before
+		event.Task = &task
+	}
+	for _, fn := range m.listeners {
+		fn(event)
+	}
+}
+
+// Seed replaces all tasks and persists them.
+func (m *TaskManager) Seed(tasks []Task, nextID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seeded := make([]Task, len(tasks))
+	for i, task := range tasks {
+		if task.Version == 0 {
+			task.Version = 1
+		}
+		deriveDueAt(&task)
+		before := task
+		settleStatus(seeded[:i], &before, &task)
+		if err := m.migrateOwners(&task); err != nil {
+			return err
+		}
+		seeded[i] = task
+	}
+	return m.commit(seeded, nextID)
+}
+
+// assignOwners fills in Owners from the Owner string when no owners are
+// given, checks that every owner is in the People registry, and stores
+// their names in Owner for readers of the raw data. Names that match
+// nobody are rejected with a *ValidationError.
+func (m *TaskManager) assignOwners(task *Task) error {
+	if len(task.Owners) == 0 {
+		ids, unknown := m.people.Match(task.Owner)
+		if len(unknown) > 0 {
+			return &ValidationError{Fields: []FieldError{unknownOwnerError(unknown)}}
+		}
+		task.Owners = ids
+	}
+	for _, id := range task.Owners {
+		if _, err := m.people.Get(id); err != nil {
+			return &ValidationError{Fields: []FieldError{{Field: "owners", Message: fmt.Sprintf("unknown person %q", id)}}}
+		}
+	}
+	if task.Owners == nil {
+		task.Owners = []PersonID{}
+	}
+	task.Owner = m.people.DisplayName(task.Owners)
+	return nil
+}
+
+// migrateOwners is assignOwners for tasks saved or seeded before the People
+// registry existed: anyone named in their owner string is added to it.
+func (m *TaskManager) migrateOwners(task *Task) error {
+	if len(task.Owners) == 0 {
+		ids, err := m.people.Resolve(task.Owner)
+		if err != nil {
+			return err
+		}
+		task.Owners = ids
+	}
+	return m.assignOwners(task)
+}
+
+// commit saves the tasks together with the next ID to hand out, then swaps
+// them in, so a failed save leaves the board as it was.
+// Callers must hold m.mu for writing.
+func (m *TaskManager) commit(tasks []Task, nextID int) error {
+	if err := m.store.Save("tasks", taskSnapshot{Tasks: tasks, NextID: nextID}); err != nil {
+		return err
+	}
+	m.tasks, m.nextID = tasks, nextID
+	return nil
+}
+
+// index returns the position of the task with the given ID, or -1.
+// Callers must hold m.mu.
+func (m *TaskManager) index(id int) int {
+	for i, task := range m.tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// List returns a copy of all tasks.
+func (m *TaskManager) List() []Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Task{}, m.tasks...)
+}
+
+// Get returns the task with the given ID.
+func (m *TaskManager) Get(id int) (Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return Task{}, ErrTaskNotFound
+	}
+	return m.tasks[i], nil
+}
+
+// Create assigns the next ID to task and stores it. Invalid tasks are
+// rejected with a *ValidationError.
+func (m *TaskManager) Create(ctx context.Context, task Task) (Task, error) {
+	created, err := m.CreateMany(ctx, []Task{task})
+	if err != nil {
+		return Task{}, err
+	}
+	return created[0], nil
+}
+
+// CreateMany stores several new tasks in one change, giving them
+// consecutive IDs. If any task is invalid none are stored, and the error
+// is that of the first invalid task.
+func (m *TaskManager) CreateMany(ctx context.Context, newTasks []Task) ([]Task, error) {
+	for _, task := range newTasks {
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	tasks := slices.Clone(m.tasks)
+	nextID := m.nextID
+	created := make([]Task, len(newTasks))
+	for _, task := range newTasks {
+		task.ID = nextID
+		task.Version = 1
+		task.CreatedAt = now
+		task.SeriesID, task.Occurrence, task.NextOccurrence = 0, 0, 0
+		if task.Recurrence != "" {
+			task.Occurrence = 1
+		}
+		task.Checklist = numberChecklist(task.Checklist, nil, task.CreatedAt)
+		deriveDueAt(&task)
+		if err := m.assignOwners(&task); err != nil {
+			return nil, err
+		}
+		if err := checkCategory(nil, task); err != nil {
+			return nil, err
+		}
+		if err := checkResident(nil, task); err != nil {
+			return nil, err
+		}
+		if err := m.checkParent(task); err != nil {
+			return nil, err
+		}
+		settleStatus(tasks, nil, &task)
+		if task.Completed {
+			task.CompletedAt = &now
+		} else {
+			task.CompletedAt = nil
+		}
+		tasks = append(tasks, task)
+		nextID++
+	}
+	// Blockers are checked once the whole batch is in, as the new tasks may
+	// block each other
+	for i := range created {
+		task := &tasks[len(m.tasks)+i]
+		if err := checkBlockers(tasks, task); err != nil {
+			return nil, err
+		}
+		if err := checkCompletable(ctx, tasks, Task{}, *task); err != nil {
+			return nil, err
+		}
+		created[i] = *task
+	}
+
+	if err := m.commit(tasks, nextID); err != nil {
+		return nil, err
+	}
+	for i := range created {
+		m.emit(ctx, ActionCreated, nil, &created[i])
+	}
+	return created, nil
+}
+
+// Update replaces the editable fields of a task. A nil Checklist or
+// BlockedBy keeps the current one. If version is non-zero it must match
+// the stored version, otherwise ErrVersionConflict is returned.
+// Invalid tasks are rejected with a *ValidationError, changes to fields the
+// account in ctx may not edit with ErrForbidden, and completing a task
+// whose blockers are open with a *BlockedError unless ctx forces it.
+func (m *TaskManager) Update(ctx context.Context, id int, updated Task, version int) (Task, error) {
+	if err := validateTask(updated); err != nil {
+		return Task{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return Task{}, ErrTaskNotFound
+	}
+	current := m.tasks[i]
+	if version != 0 && version != current.Version {
+		return Task{}, ErrVersionConflict
+	}
+
+	updated.ID = id
+	updated.Version = current.Version + 1
+	updated.CreatedAt = current.CreatedAt
+	updated.SeriesID, updated.Occurrence, updated.NextOccurrence = current.SeriesID, current.Occurrence, current.NextOccurrence
+	if updated.Recurrence != "" && updated.Occurrence == 0 {
+		updated.Occurrence = 1
+	}
+	if updated.Checklist == nil {
+		updated.Checklist = current.Checklist
+	} else {
+		updated.Checklist = numberChecklist(updated.Checklist, current.Checklist, time.Now())
+	}
+	if updated.BlockedBy == nil {
+		updated.BlockedBy = current.BlockedBy
+	}
+	deriveDueAt(&updated)
+	if err := m.assignOwners(&updated); err != nil {
+		return Task{}, err
+	}
+	if err := checkCategory(&current, updated); err != nil {
+		return Task{}, err
+	}
+	if err := checkResident(&current, updated); err != nil {
+		return Task{}, err
+	}
+	if err := m.checkParent(updated); err != nil {
+		return Task{}, err
+	}
+	if err := checkBlockers(m.tasks, &updated); err != nil {
+		return Task{}, err
+	}
+	updated.Position = current.Position
+	settleStatus(m.tasks, &current, &updated)
+	if updated.Completed && !current.Completed {
+		now := time.Now()
+		updated.CompletedAt = &now
+	} else if !updated.Completed {
+		updated.CompletedAt = nil
+	} else {
+		updated.CompletedAt = current.CompletedAt
+	}
+	if err := authorizeTaskChange(ctx, &current, &updated); err != nil {
+		return Task{}, err
+	}
+	if err := checkCompletable(ctx, m.tasks, current, updated); err != nil {
+		return Task{}, err
+	}
+
+	tasks, nextID, next := m.scheduleNext(&updated, append([]Task{}, m.tasks...), m.nextID)
+	tasks[i] = updated
+	parents := completeParents(tasks, id, time.Now())
+	if err := m.commit(tasks, nextID); err != nil {
+		return Task{}, err
+	}
+	m.emit(ctx, ActionUpdated, &current, &updated)
+	if next != nil {
+		m.emit(ctx, ActionCreated, nil, next)
+	}
+	for _, p := range parents {
+		m.emit(ctx, ActionToggled, &p[0], &p[1])
+	}
+	return updated, nil
+}
+
+// Toggle flips the completion state of a task. Completing a task whose
+// blockers are open fails with a *BlockedError unless ctx forces it.
+func (m *TaskManager) Toggle(ctx context.Context, id int) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return Task{}, ErrTaskNotFound
+	}
+	current := m.tasks[i]
+	task := current
+	task.Completed = !task.Completed
+	settleStatus(m.tasks, &current, &task)
+	if task.Completed {
+		now := time.Now()
+		task.CompletedAt = &now
+	} else {
+		task.CompletedAt = nil
+	}
+	task.Version++
+	if err := checkCompletable(ctx, m.tasks, current, task); err != nil {
+		return Task{}, err
+	}
+
+	tasks, nextID, next := m.scheduleNext(&task, append([]Task{}, m.tasks...), m.nextID)
+	tasks[i] = task
+	parents := completeParents(tasks, id, time.Now())
+	if err := m.commit(tasks, nextID); err != nil {
+		return Task{}, err
+	}
+	m.emit(ctx, ActionToggled, &current, &task)
+	if next != nil {
+		m.emit(ctx, ActionCreated, nil, next)
+	}
+	for _, p := range parents {
+		m.emit(ctx, ActionToggled, &p[0], &p[1])
+	}
+	return task, nil
+}
+
+// scheduleNext appends the next occurrence of a recurring task that has
+// just been completed to tasks, and links it from task. Each occurrence
+// creates at most one successor, however often it is toggled.
+// Callers must hold m.mu for writing.
+func (m *TaskManager) scheduleNext(task *Task, tasks []Task, nextID int) ([]Task, int, *Task) {
+	if !task.Completed || task.NextOccurrence != 0 {
+		return tasks, nextID, nil
+	}
+	next, ok := nextOccurrence(*task, time.Now())
+	if !ok {
+		return tasks, nextID, nil
+	}
+	next.ID = nextID
+	next.WorkflowStatus = ""
+	settleStatus(tasks, nil, &next)
+	task.NextOccurrence = next.ID
+	return append(tasks, next), nextID + 1, &next
+}
+
+// Delete removes a task. Its ID is never handed out again. Tasks with
+// subtasks cannot be deleted until the subtasks are deleted or moved.
+// Tasks that the deleted task blocked no longer wait on it.
+func (m *TaskManager) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return ErrTaskNotFound
+	}
+	if len(childrenOf(m.tasks, id)) > 0 {
+		return ErrHasSubtasks
+	}
+	tasks := make([]Task, 0, len(m.tasks)-1)
+	tasks = append(tasks, m.tasks[:i]...)
+	tasks = append(tasks, m.tasks[i+1:]...)
+	current := m.tasks[i]
+	unblocked := unlinkBlocker(tasks, id)
+	if err := m.commit(tasks, m.nextID); err != nil {
+		return err
+	}
+	m.emit(ctx, ActionDeleted, &current, nil)
+	for _, t := range unblocked {
+		m.emit(ctx, ActionUpdated, &t[0], &t[1])
+	}
+	return nil
+}
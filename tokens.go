@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token kinds
+const (
+	TokenPersonal = "personal" // acts as the account that created it
+	TokenService  = "service"  // acts as a named integration with its own role
+)
+
+// Token scopes
+const (
+	ScopeRead  = "read"  // GET requests only
+	ScopeWrite = "write" // any request the token's role allows
+)
+
+// tokenPrefix starts every API token, so leaked tokens are easy to spot.
+const tokenPrefix = "liz_"
+
+// lastUsedInterval limits how often a token's last-used time is saved.
+const lastUsedInterval = time.Minute
+
+var (
+	// ErrTokenNotFound is returned when no token has the requested ID.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenReadOnly is returned when a read-scoped token tries to change data.
+	ErrTokenReadOnly = errors.New("this token is read-only")
+	// ErrTokenNeedsSession is returned when a token is used to create or
+	// revoke tokens.
+	ErrTokenNeedsSession = errors.New("API tokens can only be created or revoked from a signed-in session")
+)
+
+// APIToken lets a script call the API with an Authorization: Bearer
+// header. Only a hash of the token is stored; the token itself is shown
+// once, when it is created.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	Scope      string     `json:"scope"`
+	Role       Role       `json:"role,omitempty"` // service tokens only
+	CreatedBy  string     `json:"created_by"`
+	Hint       string     `json:"hint"` // first characters of the token
+	Hash       string     `json:"hash,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the token can no longer be used.
+func (t APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(now)
+}
+
+// TokenStore holds the API tokens.
+type TokenStore struct {
+	mu     sync.RWMutex
+	store  Store
+	tokens []APIToken
+	nextID int
+}
+
+type tokenSnapshot struct {
+	Tokens []APIToken `json:"tokens"`
+	NextID int        `json:"next_id"`
+}
+
+// tokens holds the API tokens
+var tokens *TokenStore
+
+// NewTokenStore loads API tokens from store.
+func NewTokenStore(store Store) (*TokenStore, error) {
+	snap := tokenSnapshot{Tokens: []APIToken{}, NextID: 1}
+	if _, err := store.Load("tokens", &snap); err != nil {
+		return nil, err
+	}
+	return &TokenStore{store: store, tokens: snap.Tokens, nextID: snap.NextID}, nil
+}
+
+// commit saves the token hashes and the next token ID. A new token works,
+// and a revoked one stops working, only once that is on disk.
+// Callers must hold s.mu for writing.
+func (s *TokenStore) commit(list []APIToken, nextID int) error {
+	if err := s.store.Save("tokens", tokenSnapshot{Tokens: list, NextID: nextID}); err != nil {
+		return err
+	}
+	s.tokens, s.nextID = list, nextID
+	return nil
+}
+
+// List returns the tokens created by username, or every token if username
+// is empty. Hashes are left out.
+func (s *TokenStore) List(username string) []APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []APIToken{}
+	for _, t := range s.tokens {
+		if username == "" || t.CreatedBy == username {
+			t.Hash = ""
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// Get returns a token without its hash.
+func (s *TokenStore) Get(id int) (APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.ID == id {
+			t.Hash = ""
+			return t, nil
+		}
+	}
+	return APIToken{}, ErrTokenNotFound
+}
+
+// Create stores a new token and returns it along with the secret, which is
+// not kept.
+func (s *TokenStore) Create(t APIToken) (APIToken, string, error) {
+	if err := validateToken(t); err != nil {
+		return APIToken{}, "", err
+	}
+	random, err := randomToken()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	secret := tokenPrefix + random
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.ID = s.nextID
+	t.Name = strings.TrimSpace(t.Name)
+	t.Hint = secret[:len(tokenPrefix)+6]
+	t.Hash = hashToken(secret)
+	t.CreatedAt = time.Now()
+	t.LastUsedAt = nil
+	if t.Kind == TokenPersonal {
+		t.Role = ""
+	}
+	if err := s.commit(append(append([]APIToken{}, s.tokens...), t), s.nextID+1); err != nil {
+		return APIToken{}, "", err
+	}
+	t.Hash = ""
+	return t, secret, nil
+}
+
+// Revoke deletes a token.
+func (s *TokenStore) Revoke(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.tokens {
+		if t.ID == id {
+			list := append(append([]APIToken{}, s.tokens[:i]...), s.tokens[i+1:]...)
+			return s.commit(list, s.nextID)
+		}
+	}
+	return ErrTokenNotFound
+}
+
+// Authenticate finds the live token for a secret and notes that it was
+// used. It returns the account the token acts as.
+func (s *TokenStore) Authenticate(secret string) (APIToken, Account, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return APIToken{}, Account{}, false
+	}
+	hash := hashToken(secret)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.tokens {
+		if t.Hash != hash || t.Expired(now) {
+			continue
+		}
+
+		account := Account{Username: "service:" + t.Name, Role: t.Role}
+		if t.Kind == TokenPersonal {
+			var err error
+			if account, err = accounts.Get(t.CreatedBy); err != nil {
+				return APIToken{}, Account{}, false
+			}
+		}
+
+		if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= lastUsedInterval {
+			list := append([]APIToken{}, s.tokens...)
+			list[i].LastUsedAt = &now
+			// A token that works is still good if its last-used time
+			// cannot be saved.
+			if err := s.commit(list, s.nextID); err == nil {
+				t = list[i]
+			}
+		}
+		t.Hash = ""
+		return t, account, true
+	}
+	return APIToken{}, Account{}, false
+}
+
+// bearerToken returns the token in an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// tokensHandler serves /api/tokens and /api/tokens/{id}. Everyone manages
+// their own personal tokens; admins also see every token and create
+// service tokens. Tokens are created and revoked from a signed-in session
+// only, so a leaked token cannot be used to mint more.
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, bearer := bearerToken(r); bearer && !safeMethod(r.Method) {
+		writeError(w, http.StatusForbidden, ErrTokenNeedsSession.Error())
+		return
+	}
+
+	me, _ := accountFrom(r.Context())
+	admin := me.Role.Can(PermManageAccounts)
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens"), "/")
+	if idStr == "" {
+		switch r.Method {
+		case "GET":
+			owner := me.Username
+			if admin {
+				owner = ""
+			}
+			json.NewEncoder(w).Encode(tokens.List(owner))
+
+		case "POST":
+			var body struct {
+				Name      string `json:"name"`
+				Kind      string `json:"kind"`
+				Scope     string `json:"scope"`
+				Role      Role   `json:"role"`
+				ExpiresAt string `json:"expires_at"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			t := APIToken{Name: body.Name, Kind: body.Kind, Scope: body.Scope, Role: body.Role, CreatedBy: me.Username}
+			if t.Kind == "" {
+				t.Kind = TokenPersonal
+			}
+			if t.Kind == TokenService {
+				if !requirePermission(w, r, PermManageAccounts) {
+					return
+				}
+				if t.Role == "" {
+					t.Role = RoleMember
+				}
+			}
+			if body.ExpiresAt != "" {
+				expires, err := parseDueTime(body.ExpiresAt)
+				if err != nil {
+					writeValidationError(w, &ValidationError{Fields: []FieldError{{Field: "expires_at", Message: "must be an RFC 3339 time or a YYYY-MM-DD date"}}})
+					return
+				}
+				t.ExpiresAt = &expires
+			}
+
+			t, secret, err := tokens.Create(t)
+			if err != nil {
+				writeTokenError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(struct {
+				APIToken
+				Token string `json:"token"`
+			}{t, secret})
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	t, err := tokens.Get(id)
+	if err == nil && t.CreatedBy != me.Username && !admin {
+		err = ErrTokenNotFound
+	}
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(t)
+
+	case "DELETE":
+		if err := tokens.Revoke(id); err != nil {
+			writeTokenError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, r, "GET", "DELETE")
+	}
+}
+
+// writeTokenError maps TokenStore errors to HTTP status codes
+func writeTokenError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrTokenNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
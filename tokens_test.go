@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTokenScopes(t *testing.T) {
+	srv := newTestServer(t)
+	addAccount(t, "colin", RoleAdmin)
+	newToken := func(scope string) (APIToken, string) {
+		t.Helper()
+		token, secret, err := tokens.Create(APIToken{Name: scope, Kind: TokenPersonal, Scope: scope, CreatedBy: "colin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, secret
+	}
+	_, read := newToken(ScopeRead)
+	_, write := newToken(ScopeWrite)
+	revokedToken, revoked := newToken(ScopeWrite)
+	if err := tokens.Revoke(revokedToken.ID); err != nil {
+		t.Fatal(err)
+	}
+	task := map[string]string{"title": "Fix the gate", "type": categories.Name(CategoryOngoing), "priority": "Medium"}
+
+	tests := []struct {
+		name         string
+		secret       string
+		method, path string
+		body         any
+		want         int
+	}{
+		{"read token reads", read, "GET", "/api/tasks", nil, http.StatusOK},
+		{"read token cannot write", read, "POST", "/api/tasks", task, http.StatusForbidden},
+		{"write token needs no CSRF token", write, "POST", "/api/tasks", task, http.StatusOK},
+		{"unknown token", tokenPrefix + "unknown", "GET", "/api/tasks", nil, http.StatusUnauthorized},
+		{"revoked token", revoked, "GET", "/api/tasks", nil, http.StatusUnauthorized},
+		{"token lists tokens", write, "GET", "/api/tokens", nil, http.StatusOK},
+		{"token cannot create tokens", write, "POST", "/api/tokens", map[string]string{"name": "more", "scope": ScopeWrite}, http.StatusForbidden},
+		{"token cannot revoke tokens", write, "DELETE", "/api/tokens/1", nil, http.StatusForbidden},
+		{"token has no session to end", write, "DELETE", "/api/session", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := withToken(t, srv, tt.secret).do(tt.method, tt.path, tt.body, nil); got != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	// A signed-in session manages tokens
+	session := signedIn(t, srv, "colin")
+	if got := session.do("POST", "/api/tokens", map[string]string{"name": "more", "scope": ScopeRead}, nil); got != http.StatusCreated {
+		t.Errorf("creating a token from a session = %d, want %d", got, http.StatusCreated)
+	}
+	if got := session.do("DELETE", "/api/tokens/1", nil, nil); got != http.StatusNoContent {
+		t.Errorf("revoking a token from a session = %d, want %d", got, http.StatusNoContent)
+	}
+	if got := withToken(t, srv, read).do("GET", "/api/tasks", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("revoked read token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
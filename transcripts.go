@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Draft review states
+const (
+	DraftPending  = "pending"
+	DraftAccepted = "accepted"
+	DraftRejected = "rejected"
+)
+
+var (
+	// ErrTranscriptNotFound is returned when no transcript has the requested ID.
+	ErrTranscriptNotFound = errors.New("transcript not found")
+	// ErrDraftNotFound is returned when a review names a draft the transcript does not have.
+	ErrDraftNotFound = errors.New("draft not found")
+	// ErrDraftReviewed is returned when a draft has already been accepted or rejected.
+	ErrDraftReviewed = errors.New("draft has already been reviewed")
+)
+
+// DraftTask is a task proposed by the transcript extractor, waiting for
+// someone to accept or reject it.
+type DraftTask struct {
+	ID      int    `json:"id"`
+	Task    Task   `json:"task"`
+	Source  string `json:"source"`
+	Speaker string `json:"speaker,omitempty"`
+	Status  string `json:"status"`
+	TaskID  int    `json:"task_id,omitempty"`
+}
+
+// Transcript is an ingested meeting transcript and the drafts found in it.
+type Transcript struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	Format    string      `json:"format"`
+	CreatedAt time.Time   `json:"created_at"`
+	Drafts    []DraftTask `json:"drafts"`
+}
+
+// DraftDecision accepts or rejects one draft. When accepting, Task may
+// carry the reviewer's edits to the proposed task.
+type DraftDecision struct {
+	ID   int   `json:"id"`
+	Task *Task `json:"task,omitempty"`
+}
+
+// TranscriptManager stores ingested transcripts and turns accepted drafts
+// into tasks.
+type TranscriptManager struct {
+	mu          sync.Mutex
+	store       Store
+	tasks       *TaskManager
+	transcripts []Transcript
+	nextID      int
+}
+
+type transcriptSnapshot struct {
+	Transcripts []Transcript `json:"transcripts"`
+	NextID      int          `json:"next_id"`
+}
+
+// transcriptManager holds all ingested transcripts
+var transcriptManager *TranscriptManager
+
+// NewTranscriptManager loads saved transcripts from store.
+func NewTranscriptManager(store Store, tasks *TaskManager) (*TranscriptManager, error) {
+	snap := transcriptSnapshot{Transcripts: []Transcript{}, NextID: 1}
+	if _, err := store.Load("transcripts", &snap); err != nil {
+		return nil, err
+	}
+	return &TranscriptManager{
+		store:       store,
+		tasks:       tasks,
+		transcripts: snap.Transcripts,
+		nextID:      snap.NextID,
+	}, nil
+}
+
+// commit saves the transcripts, with their draft tasks, and the
+// next transcript ID before swapping them in. Callers must hold m.mu.
+func (m *TranscriptManager) commit(transcripts []Transcript, nextID int) error {
+	if err := m.store.Save("transcripts", transcriptSnapshot{Transcripts: transcripts, NextID: nextID}); err != nil {
+		return err
+	}
+	m.transcripts, m.nextID = transcripts, nextID
+	return nil
+}
+
+// List returns all transcripts, newest first.
+func (m *TranscriptManager) List() []Transcript {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := append([]Transcript{}, m.transcripts...)
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+// Get returns the transcript with the given ID.
+func (m *TranscriptManager) Get(id int) (Transcript, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.transcripts {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return Transcript{}, ErrTranscriptNotFound
+}
+
+// Ingest extracts draft tasks from a transcript and saves them for review.
+func (m *TranscriptManager) Ingest(name, text string) (Transcript, error) {
+	format := "text"
+	if strings.HasPrefix(strings.TrimSpace(text), "WEBVTT") {
+		format = "vtt"
+	}
+	drafts := extractDraftTasks(text, people.Names())
+	if drafts == nil {
+		drafts = []DraftTask{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := Transcript{
+		ID:        m.nextID,
+		Name:      name,
+		Format:    format,
+		CreatedAt: time.Now(),
+		Drafts:    drafts,
+	}
+	if t.Name == "" {
+		t.Name = "Transcript " + strconv.Itoa(t.ID)
+	}
+	if err := m.commit(append(append([]Transcript{}, m.transcripts...), t), m.nextID+1); err != nil {
+		return Transcript{}, err
+	}
+	return t, nil
+}
+
+// Review accepts or rejects pending drafts. Accepted drafts are created as
+// tasks in one batch, so either all of them become tasks or none do; the
+// updated transcript and the new tasks are returned.
+func (m *TranscriptManager) Review(ctx context.Context, id int, accept bool, decisions []DraftDecision) (Transcript, []Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := -1
+	for j, t := range m.transcripts {
+		if t.ID == id {
+			i = j
+		}
+	}
+	if i < 0 {
+		return Transcript{}, nil, ErrTranscriptNotFound
+	}
+	t := m.transcripts[i]
+	t.Drafts = append([]DraftTask{}, t.Drafts...)
+
+	// Check every decision before creating anything.
+	positions := make([]int, len(decisions))
+	for n, d := range decisions {
+		if slices.ContainsFunc(decisions[:n], func(other DraftDecision) bool { return other.ID == d.ID }) {
+			return Transcript{}, nil, &ValidationError{Fields: []FieldError{{Field: "drafts", Message: fmt.Sprintf("draft %d is listed more than once", d.ID)}}}
+		}
+		positions[n] = -1
+		for j, draft := range t.Drafts {
+			if draft.ID == d.ID {
+				positions[n] = j
+			}
+		}
+		if positions[n] < 0 {
+			return Transcript{}, nil, ErrDraftNotFound
+		}
+		if t.Drafts[positions[n]].Status != DraftPending {
+			return Transcript{}, nil, ErrDraftReviewed
+		}
+	}
+
+	var created []Task
+	if accept {
+		batch := make([]Task, len(decisions))
+		for n, d := range decisions {
+			if d.Task != nil {
+				t.Drafts[positions[n]].Task = *d.Task
+			}
+			batch[n] = t.Drafts[positions[n]].Task
+		}
+		var err error
+		if created, err = m.tasks.CreateMany(ctx, batch); err != nil {
+			return Transcript{}, nil, err
+		}
+	}
+	for n := range decisions {
+		draft := &t.Drafts[positions[n]]
+		if accept {
+			draft.Status, draft.TaskID = DraftAccepted, created[n].ID
+		} else {
+			draft.Status = DraftRejected
+		}
+	}
+
+	transcripts := append([]Transcript{}, m.transcripts...)
+	transcripts[i] = t
+	if err := m.commit(transcripts, m.nextID); err != nil {
+		// Leave the drafts pending with no tasks made from them, so the
+		// review can be retried
+		for _, task := range created {
+			if err := m.tasks.Delete(ctx, task.ID); err != nil {
+				log.Printf("transcripts: removing task %d after a failed review: %v", task.ID, err)
+			}
+		}
+		return Transcript{}, nil, err
+	}
+	return t, created, nil
+}
+
+// RenameType moves pending drafts of one task type to another, following
+// a category rename. Reviewed drafts keep the type they were reviewed with.
+func (m *TranscriptManager) RenameType(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transcripts := slices.Clone(m.transcripts)
+	changed := false
+	for i, t := range transcripts {
+		drafts := slices.Clone(t.Drafts)
+		for j := range drafts {
+			if drafts[j].Status == DraftPending && drafts[j].Task.Type == from {
+				drafts[j].Task.Type = to
+				transcripts[i].Drafts = drafts
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.commit(transcripts, m.nextID)
+}
+
+// Delete discards a transcript and any drafts still pending review.
+func (m *TranscriptManager) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.transcripts {
+		if t.ID == id {
+			transcripts := append(append([]Transcript{}, m.transcripts[:i]...), m.transcripts[i+1:]...)
+			return m.commit(transcripts, m.nextID)
+		}
+	}
+	return ErrTranscriptNotFound
+}
+
+// transcriptsHandler serves /api/transcripts and /api/transcripts/{id}[/accept|/reject]
+func transcriptsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Reviewing transcripts turns drafts into tasks
+	if !safeMethod(r.Method) && !requirePermission(w, r, PermCreateTask) {
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/transcripts"), "/")
+	if path == "" {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(transcriptManager.List())
+
+		case "POST":
+			name, text, err := readTranscript(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			t, err := transcriptManager.Ingest(name, text)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(t)
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid transcript ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		t, err := transcriptManager.Get(id)
+		if err != nil {
+			writeTranscriptError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+
+	case action == "" && r.Method == "DELETE":
+		if err := transcriptManager.Delete(id); err != nil {
+			writeTranscriptError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case (action == "accept" || action == "reject") && r.Method == "POST":
+		var body struct {
+			Drafts []DraftDecision `json:"drafts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		t, created, err := transcriptManager.Review(r.Context(), id, action == "accept", body.Drafts)
+		if err != nil {
+			writeTranscriptError(w, err)
+			return
+		}
+		if created == nil {
+			created = []Task{}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"transcript": t, "tasks": created})
+
+	case action == "":
+		methodNotAllowed(w, r, "GET", "DELETE")
+
+	case action == "accept" || action == "reject":
+		methodNotAllowed(w, r, "POST")
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// readTranscript accepts either a raw text/VTT body (named by ?name=) or a
+// JSON object with name and text fields.
+func readTranscript(r *http.Request) (name, text string, err error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Name string `json:"name"`
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return "", "", err
+		}
+		name, text = body.Name, body.Text
+	} else {
+		data, err := io.ReadAll(io.LimitReader(r.Body, 5<<20))
+		if err != nil {
+			return "", "", err
+		}
+		name, text = r.URL.Query().Get("name"), string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", "", errors.New("transcript is empty")
+	}
+	return name, text, nil
+}
+
+// writeTranscriptError maps TranscriptManager errors to HTTP status codes
+func writeTranscriptError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrTranscriptNotFound), errors.Is(err, ErrDraftNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrDraftReviewed):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
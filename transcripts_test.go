@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTranscriptReviewIsAllOrNothing(t *testing.T) {
+	newTestStore(t)
+	addPerson(t, "Ana", "")
+	ctx := context.Background()
+	tr, err := transcriptManager.Ingest("Site meeting", "Ana: I will fix the gate tomorrow.\nAna: We need to order new bins.\nColin: Ana will call the plumber.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Drafts) != 3 {
+		t.Fatalf("got %d drafts, want 3", len(tr.Drafts))
+	}
+	pending := func() int {
+		t.Helper()
+		tr, err := transcriptManager.Get(tr.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, d := range tr.Drafts {
+			if d.Status == DraftPending {
+				n++
+			}
+		}
+		return n
+	}
+
+	var invalid *ValidationError
+	_, _, err = transcriptManager.Review(ctx, tr.ID, true, []DraftDecision{{ID: 1}, {ID: 1}})
+	if !errors.As(err, &invalid) {
+		t.Errorf("accepting a draft twice in one review: error = %v, want a validation error", err)
+	}
+	untitled := tr.Drafts[1].Task
+	untitled.Title = ""
+	_, _, err = transcriptManager.Review(ctx, tr.ID, true, []DraftDecision{{ID: 1}, {ID: 2, Task: &untitled}})
+	if !errors.As(err, &invalid) {
+		t.Errorf("accepting an invalid draft: error = %v, want a validation error", err)
+	}
+	if n := len(taskManager.List()); n != 0 || pending() != 3 {
+		t.Fatalf("failed reviews left %d tasks and %d of 3 drafts pending", n, pending())
+	}
+
+	_, created, err := transcriptManager.Review(ctx, tr.ID, true, []DraftDecision{{ID: 1}, {ID: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 || len(taskManager.List()) != 2 || pending() != 1 {
+		t.Errorf("accepting 2 drafts created %d tasks, leaving %d pending", len(created), pending())
+	}
+	if _, _, err := transcriptManager.Review(ctx, tr.ID, true, []DraftDecision{{ID: 3}, {ID: 2}}); !errors.Is(err, ErrDraftReviewed) {
+		t.Errorf("accepting a draft again: error = %v, want %v", err, ErrDraftReviewed)
+	}
+	if _, created, err := transcriptManager.Review(ctx, tr.ID, false, []DraftDecision{{ID: 3}}); err != nil || len(created) != 0 {
+		t.Errorf("rejecting a draft = %v, %v; want no tasks", created, err)
+	}
+	if n := len(taskManager.List()); n != 2 || pending() != 0 {
+		t.Errorf("after every review: %d tasks and %d drafts pending, want 2 and 0", n, pending())
+	}
+}
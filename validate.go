@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Length limits for task fields, in characters.
+const (
+	maxTitleLength = 200
+	maxOwnerLength = 200
+	maxNotesLength = 10000
+
+	maxTokenNameLength    = 100
+	maxCategoryNameLength = 100
+	maxWindowHours        = 366 * 24
+
+	maxWebhookSecretLength = 200
+	maxZohoSyncMinutes     = 24 * 60
+)
+
+// Password length limits. bcrypt ignores everything after 72 bytes.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,31}$`)
+	colorPattern    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	// zohoNamePattern matches Zoho CRM module and field API names
+	zohoNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+)
+
+// validateTask checks the fields a client can set on a task. It returns
+// nil when the task is valid.
+func validateTask(task Task) *ValidationError {
+	var fields []FieldError
+	add := func(field, format string, args ...any) {
+		fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch title := strings.TrimSpace(task.Title); {
+	case title == "":
+		add("title", "is required")
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		add("title", "must be at most %d characters", maxTitleLength)
+	}
+
+	switch {
+	case task.Type == "":
+		add("type", "is required")
+	default:
+		if _, ok := categories.Named(task.Type); !ok {
+			add("type", "must be one of: %s", strings.Join(categories.Names(), "; "))
+		}
+	}
+
+	switch {
+	case task.Priority == "":
+		add("priority", "is required")
+	case !slices.Contains(taskPriorities, task.Priority):
+		add("priority", "must be one of: %s", strings.Join(taskPriorities, ", "))
+	}
+
+	if utf8.RuneCountInString(task.Owner) > maxOwnerLength {
+		add("owner", "must be at most %d characters", maxOwnerLength)
+	}
+	if utf8.RuneCountInString(task.Notes) > maxNotesLength {
+		add("notes", "must be at most %d characters", maxNotesLength)
+	}
+	if task.ParentID < 0 {
+		add("parent_id", "must be a task ID")
+	}
+	if task.WorkflowStatus != "" {
+		if _, ok := workflow.Lookup(task.WorkflowStatus); !ok {
+			add("workflow_status", "unknown workflow status %q", task.WorkflowStatus)
+		}
+	}
+	for i, id := range task.BlockedBy {
+		if id <= 0 {
+			add(fmt.Sprintf("blocked_by[%d]", i), "must be a task ID")
+		}
+	}
+	for i, item := range task.Checklist {
+		if err := validateChecklistItem(item.Text); err != nil {
+			add(fmt.Sprintf("checklist[%d].text", i), "%s", err.Fields[0].Message)
+		}
+	}
+	if task.Recurrence != "" {
+		if _, err := parseRRule(task.Recurrence); err != nil {
+			add("recurrence", "%v", err)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateChecklistItem checks the text of a checklist item.
+func validateChecklistItem(text string) *ValidationError {
+	switch text = strings.TrimSpace(text); {
+	case text == "":
+		return &ValidationError{Fields: []FieldError{{Field: "text", Message: "is required"}}}
+	case utf8.RuneCountInString(text) > maxChecklistItemLength:
+		return &ValidationError{Fields: []FieldError{{Field: "text", Message: fmt.Sprintf("must be at most %d characters", maxChecklistItemLength)}}}
+	}
+	return nil
+}
+
+// validatePerson checks the fields of a People registry entry.
+func validatePerson(p Person) *ValidationError {
+	var fields []FieldError
+	switch name := strings.TrimSpace(p.Name); {
+	case name == "":
+		fields = append(fields, FieldError{Field: "name", Message: "is required"})
+	case utf8.RuneCountInString(name) > maxOwnerLength:
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxOwnerLength)})
+	}
+	if p.Email != "" && !strings.Contains(p.Email, "@") {
+		fields = append(fields, FieldError{Field: "email", Message: "is not a valid address"})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateNotificationPrefs checks a person's email settings.
+func validateNotificationPrefs(p NotificationPrefs) *ValidationError {
+	var fields []FieldError
+	if p.Email != "" && !strings.Contains(p.Email, "@") {
+		fields = append(fields, FieldError{Field: "email", Message: "is not a valid address"})
+	}
+	if p.DigestHour < 0 || p.DigestHour > 23 {
+		fields = append(fields, FieldError{Field: "digest_hour", Message: "must be between 0 and 23"})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateWebhook checks the fields of an outbound webhook.
+func validateWebhook(h Webhook) *ValidationError {
+	var fields []FieldError
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fields = append(fields, FieldError{Field: "url", Message: "must be an http or https URL"})
+	}
+	for _, event := range h.Events {
+		if !slices.Contains(webhookEvents, event) {
+			fields = append(fields, FieldError{Field: "events", Message: fmt.Sprintf("unknown event %q; use one of %s", event, strings.Join(webhookEvents, ", "))})
+		}
+	}
+	if len(h.Secret) > maxWebhookSecretLength {
+		fields = append(fields, FieldError{Field: "secret", Message: fmt.Sprintf("must be at most %d characters", maxWebhookSecretLength)})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateCalendlyConfig checks how Calendly bookings are turned into tasks.
+func validateCalendlyConfig(c CalendlyConfig) *ValidationError {
+	var fields []FieldError
+	checkMapping := func(prefix, owner, taskType, priority string) {
+		if owner != "" {
+			if _, ok := people.Lookup(owner); !ok {
+				fields = append(fields, FieldError{Field: prefix + "owner", Message: fmt.Sprintf("unknown person %q", owner)})
+			}
+		}
+		if taskType != "" {
+			if category, ok := categories.Named(taskType); !ok || category.Archived {
+				fields = append(fields, FieldError{Field: prefix + "type", Message: "must be one of: " + strings.Join(categories.Names(), ", ")})
+			}
+		}
+		if priority != "" && !slices.Contains(taskPriorities, priority) {
+			fields = append(fields, FieldError{Field: prefix + "priority", Message: "must be one of: " + strings.Join(taskPriorities, ", ")})
+		}
+	}
+
+	checkMapping("", c.Owner, c.Type, c.Priority)
+	if c.Owner == "" {
+		fields = append(fields, FieldError{Field: "owner", Message: "is required"})
+	}
+	if c.Type == "" {
+		fields = append(fields, FieldError{Field: "type", Message: "is required"})
+	}
+	if c.Priority == "" {
+		fields = append(fields, FieldError{Field: "priority", Message: "is required"})
+	}
+	for i, rule := range c.Rules {
+		prefix := fmt.Sprintf("rules[%d].", i)
+		if strings.TrimSpace(rule.EventType) == "" {
+			fields = append(fields, FieldError{Field: prefix + "event_type", Message: "is required"})
+		}
+		checkMapping(prefix, rule.Owner, rule.Type, rule.Priority)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateZohoConfig checks where and how residents are pulled from Zoho.
+func validateZohoConfig(c ZohoConfig) *ValidationError {
+	var fields []FieldError
+	for _, u := range []struct{ field, value string }{{"accounts_url", c.AccountsURL}, {"api_domain", c.APIDomain}} {
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fields = append(fields, FieldError{Field: u.field, Message: "must be an http or https URL"})
+		}
+	}
+	if !zohoNamePattern.MatchString(c.Module) {
+		fields = append(fields, FieldError{Field: "module", Message: "must be a Zoho module API name such as Contacts"})
+	}
+	if c.Fields.Name == "" {
+		fields = append(fields, FieldError{Field: "fields.name", Message: "is required"})
+	}
+	mapping := []struct{ field, value string }{
+		{"name", c.Fields.Name}, {"email", c.Fields.Email}, {"phone", c.Fields.Phone}, {"unit", c.Fields.Unit},
+		{"status", c.Fields.Status}, {"move_in", c.Fields.MoveIn}, {"move_out", c.Fields.MoveOut},
+	}
+	for _, m := range mapping {
+		if m.value != "" && !zohoNamePattern.MatchString(m.value) {
+			fields = append(fields, FieldError{Field: "fields." + m.field, Message: "must be a Zoho field API name such as Last_Name"})
+		}
+	}
+	if c.SyncMinutes != 0 && (c.SyncMinutes < 5 || c.SyncMinutes > maxZohoSyncMinutes) {
+		fields = append(fields, FieldError{Field: "sync_minutes", Message: fmt.Sprintf("must be 0 or between 5 and %d", maxZohoSyncMinutes)})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateCategory checks the fields of a task category.
+func validateCategory(c Category) *ValidationError {
+	var fields []FieldError
+	switch name := strings.TrimSpace(c.Name); {
+	case name == "":
+		fields = append(fields, FieldError{Field: "name", Message: "is required"})
+	case utf8.RuneCountInString(name) > maxCategoryNameLength:
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxCategoryNameLength)})
+	}
+	if c.Color != "" && !colorPattern.MatchString(c.Color) {
+		fields = append(fields, FieldError{Field: "color", Message: "must be a colour such as #667eea"})
+	}
+	if c.WindowHours < 0 || c.WindowHours > maxWindowHours {
+		fields = append(fields, FieldError{Field: "window_hours", Message: fmt.Sprintf("must be between 0 and %d", maxWindowHours)})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateWorkflow checks a list of board columns: each needs a unique ID
+// and a name, and there must be at least one open and one done column.
+func validateWorkflow(list []WorkflowStatus) *ValidationError {
+	var fields []FieldError
+	var open, done bool
+	for i, s := range list {
+		if !workflowIDPattern.MatchString(s.ID) {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("[%d].id", i), Message: "must be 1-32 lowercase letters, digits, '_' or '-'"})
+		} else if slices.ContainsFunc(list[:i], func(o WorkflowStatus) bool { return o.ID == s.ID }) {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("[%d].id", i), Message: "is used twice"})
+		}
+		switch {
+		case s.Name == "":
+			fields = append(fields, FieldError{Field: fmt.Sprintf("[%d].name", i), Message: "is required"})
+		case utf8.RuneCountInString(s.Name) > maxCategoryNameLength:
+			fields = append(fields, FieldError{Field: fmt.Sprintf("[%d].name", i), Message: fmt.Sprintf("must be at most %d characters", maxCategoryNameLength)})
+		}
+		open = open || !s.Done
+		done = done || s.Done
+	}
+	if !open || !done {
+		fields = append(fields, FieldError{Field: "done", Message: "at least one status must be done and one not"})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateToken checks the fields of a new API token.
+func validateToken(t APIToken) *ValidationError {
+	var fields []FieldError
+	switch name := strings.TrimSpace(t.Name); {
+	case name == "":
+		fields = append(fields, FieldError{Field: "name", Message: "is required"})
+	case utf8.RuneCountInString(name) > maxTokenNameLength:
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxTokenNameLength)})
+	}
+	if t.Kind != TokenPersonal && t.Kind != TokenService {
+		fields = append(fields, FieldError{Field: "kind", Message: "must be personal or service"})
+	}
+	if t.Scope != ScopeRead && t.Scope != ScopeWrite {
+		fields = append(fields, FieldError{Field: "scope", Message: "must be read or write"})
+	}
+	if t.Kind == TokenService {
+		if err := validateRole(t.Role); err != nil {
+			fields = append(fields, err.Fields...)
+		}
+	}
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now()) {
+		fields = append(fields, FieldError{Field: "expires_at", Message: "must be in the future"})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validateRole checks that role is one of roles.
+func validateRole(role Role) *ValidationError {
+	if slices.Contains(roles, role) {
+		return nil
+	}
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = string(r)
+	}
+	return &ValidationError{Fields: []FieldError{{Field: "role", Message: "must be one of: " + strings.Join(names, ", ")}}}
+}
+
+// validateAccount checks a username and password for a new account or a
+// password change.
+func validateAccount(username, password string) *ValidationError {
+	var fields []FieldError
+	if !usernamePattern.MatchString(strings.ToLower(username)) {
+		fields = append(fields, FieldError{Field: "username", Message: "must be 3-32 letters, digits, '.', '_' or '-'"})
+	}
+	switch {
+	case utf8.RuneCountInString(password) < minPasswordLength:
+		fields = append(fields, FieldError{Field: "password", Message: fmt.Sprintf("must be at least %d characters", minPasswordLength)})
+	case len(password) > maxPasswordLength:
+		fields = append(fields, FieldError{Field: "password", Message: fmt.Sprintf("must be at most %d bytes", maxPasswordLength)})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
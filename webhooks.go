@@ -0,0 +1,660 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook events
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskReopened  = "task.reopened"
+	EventTaskDeleted   = "task.deleted"
+)
+
+// webhookEvents lists every event a webhook can subscribe to.
+var webhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskCompleted, EventTaskReopened, EventTaskDeleted}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// webhookRetryDelays are the waits before each retry of a failed delivery.
+// A delivery that fails once more after the last is given up on.
+var webhookRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+
+const (
+	// webhookTimeout limits each delivery attempt.
+	webhookTimeout = 10 * time.Second
+	// maxDeliveries is how many deliveries the log keeps.
+	maxDeliveries = 1000
+	// signatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the webhook's secret.
+	signatureHeader = "X-Liz-Signature"
+)
+
+var (
+	// ErrWebhookNotFound is returned when no webhook has the requested ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when a webhook has no delivery with the requested ID.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// Webhook posts task events to a URL.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only shown when the webhook is created
+	Events    []string  `json:"events,omitempty"` // empty for every event
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to event.
+func (h Webhook) Wants(event string) bool {
+	return h.Active && (len(h.Events) == 0 || slices.Contains(h.Events, event))
+}
+
+// WebhookPayload is the JSON body posted to a webhook.
+type WebhookPayload struct {
+	Event      string        `json:"event"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	Actor      string        `json:"actor"`
+	Task       Task          `json:"task"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+// WebhookDelivery is one event sent, or being sent, to one webhook.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	RedeliveryOf   int             `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+}
+
+// WebhookRegistry holds the webhooks and the log of their deliveries.
+type WebhookRegistry struct {
+	mu             sync.Mutex
+	store          Store
+	client         *http.Client
+	hooks          []Webhook
+	nextID         int
+	deliveries     []WebhookDelivery
+	nextDeliveryID int
+	events         chan TaskEvent // for Run to queue deliveries of
+}
+
+type webhookSnapshot struct {
+	Hooks  []Webhook `json:"hooks"`
+	NextID int       `json:"next_id"`
+}
+
+type deliverySnapshot struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextID     int               `json:"next_id"`
+}
+
+// webhooks holds the outbound webhooks
+var webhooks *WebhookRegistry
+
+// NewWebhookRegistry loads webhooks and their delivery log from store.
+func NewWebhookRegistry(store Store) (*WebhookRegistry, error) {
+	hooks := webhookSnapshot{Hooks: []Webhook{}, NextID: 1}
+	if _, err := store.Load("webhooks", &hooks); err != nil {
+		return nil, err
+	}
+	deliveries := deliverySnapshot{Deliveries: []WebhookDelivery{}, NextID: 1}
+	if _, err := store.Load("webhook_deliveries", &deliveries); err != nil {
+		return nil, err
+	}
+	return &WebhookRegistry{
+		store:          store,
+		client:         &http.Client{Timeout: webhookTimeout},
+		hooks:          hooks.Hooks,
+		nextID:         hooks.NextID,
+		deliveries:     deliveries.Deliveries,
+		nextDeliveryID: deliveries.NextID,
+		events:         make(chan TaskEvent, 256),
+	}, nil
+}
+
+// commit saves the webhook subscriptions and the next webhook ID. Events
+// go to a new or changed webhook only once it is stored.
+// Callers must hold r.mu.
+func (r *WebhookRegistry) commit(list []Webhook, nextID int) error {
+	if err := r.store.Save("webhooks", webhookSnapshot{Hooks: list, NextID: nextID}); err != nil {
+		return err
+	}
+	r.hooks, r.nextID = list, nextID
+	return nil
+}
+
+// commitDeliveries persists the delivery log, dropping the oldest finished
+// deliveries beyond maxDeliveries. Callers must hold r.mu.
+func (r *WebhookRegistry) commitDeliveries(list []WebhookDelivery, nextID int) error {
+	for excess := len(list) - maxDeliveries; excess > 0; excess-- {
+		i := slices.IndexFunc(list, func(d WebhookDelivery) bool { return d.Status != DeliveryPending })
+		if i < 0 {
+			break
+		}
+		list = slices.Delete(list, i, i+1)
+	}
+	if err := r.store.Save("webhook_deliveries", deliverySnapshot{Deliveries: list, NextID: nextID}); err != nil {
+		return err
+	}
+	r.deliveries, r.nextDeliveryID = list, nextID
+	return nil
+}
+
+// List returns every webhook without its secret.
+func (r *WebhookRegistry) List() []Webhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Webhook, len(r.hooks))
+	for i, h := range r.hooks {
+		h.Secret = ""
+		list[i] = h
+	}
+	return list
+}
+
+// Get returns a webhook without its secret.
+func (r *WebhookRegistry) Get(id int) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	h := r.hooks[i]
+	h.Secret = ""
+	return h, nil
+}
+
+// index returns the position of webhook id, or -1. Callers must hold r.mu.
+func (r *WebhookRegistry) index(id int) int {
+	return slices.IndexFunc(r.hooks, func(h Webhook) bool { return h.ID == id })
+}
+
+// Create adds a webhook, generating a secret if it has none. The secret is
+// returned this once.
+func (r *WebhookRegistry) Create(h Webhook) (Webhook, error) {
+	if err := validateWebhook(h); err != nil {
+		return Webhook{}, err
+	}
+	if h.Secret == "" {
+		secret, err := randomToken()
+		if err != nil {
+			return Webhook{}, err
+		}
+		h.Secret = secret
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h.ID = r.nextID
+	h.CreatedAt = time.Now()
+	if err := r.commit(append(slices.Clone(r.hooks), h), r.nextID+1); err != nil {
+		return Webhook{}, err
+	}
+	return h, nil
+}
+
+// Update changes a webhook's URL, events and active flag, and its secret
+// if a new one is given.
+func (r *WebhookRegistry) Update(id int, h Webhook) (Webhook, error) {
+	if err := validateWebhook(h); err != nil {
+		return Webhook{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	current := r.hooks[i]
+	h.ID, h.CreatedBy, h.CreatedAt = current.ID, current.CreatedBy, current.CreatedAt
+	if h.Secret == "" {
+		h.Secret = current.Secret
+	}
+	list := slices.Clone(r.hooks)
+	list[i] = h
+	if err := r.commit(list, r.nextID); err != nil {
+		return Webhook{}, err
+	}
+	h.Secret = ""
+	return h, nil
+}
+
+// Delete removes a webhook. Its deliveries stay in the log, and pending
+// ones fail at their next attempt.
+func (r *WebhookRegistry) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return ErrWebhookNotFound
+	}
+	return r.commit(slices.Delete(slices.Clone(r.hooks), i, i+1), r.nextID)
+}
+
+// Deliveries returns a webhook's deliveries, newest first.
+func (r *WebhookRegistry) Deliveries(id int) ([]WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index(id) < 0 {
+		return nil, ErrWebhookNotFound
+	}
+	list := []WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0; i-- {
+		if r.deliveries[i].WebhookID == id {
+			list = append(list, r.deliveries[i])
+		}
+	}
+	return list, nil
+}
+
+// webhookEvent names the webhook event for a task change.
+func webhookEvent(event TaskEvent) string {
+	switch event.Action {
+	case ActionCreated:
+		return EventTaskCreated
+	case ActionDeleted:
+		return EventTaskDeleted
+	}
+	for _, c := range event.Changes {
+		if c.Field == "completed" {
+			if c.To == true {
+				return EventTaskCompleted
+			}
+			return EventTaskReopened
+		}
+	}
+	return EventTaskUpdated
+}
+
+// Notify queues a task event for the webhooks. It is a TaskManager
+// listener, so it must not block or call back into the manager; Run does
+// the work.
+func (r *WebhookRegistry) Notify(event TaskEvent) {
+	select {
+	case r.events <- event:
+	default:
+		log.Printf("webhooks: queue full, dropping %s of task %d", event.Action, event.TaskID)
+	}
+}
+
+// Run queues deliveries of notified events until the process exits. Events
+// notified while the last ones were saved are logged together.
+func (r *WebhookRegistry) Run() {
+	for event := range r.events {
+		batch := []TaskEvent{event}
+		for len(r.events) > 0 {
+			batch = append(batch, <-r.events)
+		}
+		r.queue(batch)
+	}
+}
+
+// queue adds a delivery of each event to every webhook that wants it and
+// starts sending them.
+func (r *WebhookRegistry) queue(events []TaskEvent) {
+	type payload struct {
+		name string
+		data []byte
+		at   time.Time
+	}
+	payloads := make([]payload, 0, len(events))
+	for _, event := range events {
+		name := webhookEvent(event)
+		data, err := json.Marshal(WebhookPayload{
+			Event:      name,
+			OccurredAt: event.At,
+			Actor:      event.Actor,
+			Task:       *event.Task,
+			Changes:    event.Changes,
+		})
+		if err != nil {
+			log.Printf("webhooks: encoding %s of task %d: %v", name, event.TaskID, err)
+			continue
+		}
+		payloads = append(payloads, payload{name, data, event.At})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := slices.Clone(r.deliveries)
+	nextID := r.nextDeliveryID
+	var queued []int
+	for _, p := range payloads {
+		for _, h := range r.hooks {
+			if !h.Wants(p.name) {
+				continue
+			}
+			list = append(list, WebhookDelivery{
+				ID:        nextID,
+				WebhookID: h.ID,
+				Event:     p.name,
+				Payload:   p.data,
+				Status:    DeliveryPending,
+				CreatedAt: p.at,
+			})
+			queued = append(queued, nextID)
+			nextID++
+		}
+	}
+	if len(queued) == 0 {
+		return
+	}
+	if err := r.commitDeliveries(list, nextID); err != nil {
+		log.Printf("webhooks: queueing %d deliveries: %v", len(queued), err)
+		return
+	}
+	for _, id := range queued {
+		go r.attempt(id)
+	}
+}
+
+// Resume schedules the deliveries that were pending when the server stopped.
+func (r *WebhookRegistry) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, d := range r.deliveries {
+		if d.Status != DeliveryPending {
+			continue
+		}
+		var wait time.Duration
+		if d.NextAttemptAt != nil {
+			wait = max(d.NextAttemptAt.Sub(now), 0)
+		}
+		id := d.ID
+		time.AfterFunc(wait, func() { r.attempt(id) })
+	}
+}
+
+// Redeliver sends a copy of an earlier delivery now, retrying as usual if
+// it fails. It returns the new delivery after its first attempt.
+func (r *WebhookRegistry) Redeliver(hookID, deliveryID int) (WebhookDelivery, error) {
+	r.mu.Lock()
+	if r.index(hookID) < 0 {
+		r.mu.Unlock()
+		return WebhookDelivery{}, ErrWebhookNotFound
+	}
+	i := slices.IndexFunc(r.deliveries, func(d WebhookDelivery) bool { return d.ID == deliveryID && d.WebhookID == hookID })
+	if i < 0 {
+		r.mu.Unlock()
+		return WebhookDelivery{}, ErrDeliveryNotFound
+	}
+	original := r.deliveries[i]
+	d := WebhookDelivery{
+		ID:           r.nextDeliveryID,
+		WebhookID:    hookID,
+		Event:        original.Event,
+		Payload:      original.Payload,
+		Status:       DeliveryPending,
+		RedeliveryOf: original.ID,
+		CreatedAt:    time.Now(),
+	}
+	err := r.commitDeliveries(append(slices.Clone(r.deliveries), d), r.nextDeliveryID+1)
+	r.mu.Unlock()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	return r.attempt(d.ID), nil
+}
+
+// attempt sends a pending delivery once and records the outcome, scheduling
+// a retry if it failed and has retries left. It returns the delivery as
+// recorded.
+func (r *WebhookRegistry) attempt(id int) WebhookDelivery {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.deliveries, func(d WebhookDelivery) bool { return d.ID == id })
+	if i < 0 {
+		r.mu.Unlock()
+		return WebhookDelivery{}
+	}
+	d := r.deliveries[i]
+	var hook Webhook
+	if j := r.index(d.WebhookID); j >= 0 {
+		hook = r.hooks[j]
+	}
+	r.mu.Unlock()
+	if d.Status != DeliveryPending {
+		return d
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.NextAttemptAt = nil
+	d.ResponseStatus = 0
+	d.Error = ""
+	retry := true
+	switch {
+	case hook.ID == 0:
+		d.Error, retry = "webhook was deleted", false
+	case !hook.Active:
+		d.Error, retry = "webhook is disabled", false
+	default:
+		d.ResponseStatus, d.Error = r.post(hook, d)
+	}
+
+	switch {
+	case d.Error == "":
+		d.Status = DeliveryDelivered
+	case retry && d.Attempts <= len(webhookRetryDelays):
+		next := now.Add(webhookRetryDelays[d.Attempts-1])
+		d.NextAttemptAt = &next
+		time.AfterFunc(time.Until(next), func() { r.attempt(id) })
+	default:
+		d.Status = DeliveryFailed
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.IndexFunc(r.deliveries, func(x WebhookDelivery) bool { return x.ID == id }); i >= 0 {
+		list := slices.Clone(r.deliveries)
+		list[i] = d
+		if err := r.commitDeliveries(list, r.nextDeliveryID); err != nil {
+			log.Printf("webhooks: recording delivery %d: %v", id, err)
+		}
+	}
+	return d
+}
+
+// post sends a delivery's payload, signed with the webhook's secret. It
+// returns the response status and, unless the status was 2xx, what went
+// wrong.
+func (r *WebhookRegistry) post(hook Webhook, d WebhookDelivery) (int, string) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write(d.Payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AMSKU-Tasks-Webhook/1")
+	req.Header.Set("X-Liz-Event", d.Event)
+	req.Header.Set("X-Liz-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, "endpoint answered " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// webhooksHandler serves /api/webhooks and everything under it:
+//
+//	GET, POST   /api/webhooks
+//	GET, PUT, DELETE /api/webhooks/{id}
+//	GET         /api/webhooks/{id}/deliveries
+//	POST        /api/webhooks/{id}/deliveries/{delivery}/redeliver
+//
+// Webhooks carry secrets, so all of it needs PermManageWebhooks.
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !requirePermission(w, r, PermManageWebhooks) {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/webhooks"), "/"), "/")
+	if parts[0] == "" {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(webhooks.List())
+
+		case "POST":
+			h := Webhook{Active: true}
+			if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			h.URL = strings.TrimSpace(h.URL)
+			h.CreatedBy = actorFrom(r.Context())
+			h, err := webhooks.Create(h)
+			if err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(h)
+
+		default:
+			methodNotAllowed(w, r, "GET", "POST")
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case "GET":
+			h, err := webhooks.Get(id)
+			if err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(h)
+
+		case "PUT":
+			h := Webhook{Active: true}
+			if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+			h.URL = strings.TrimSpace(h.URL)
+			h, err := webhooks.Update(id, h)
+			if err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(h)
+
+		case "DELETE":
+			if err := webhooks.Delete(id); err != nil {
+				writeWebhookError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			methodNotAllowed(w, r, "GET", "PUT", "DELETE")
+		}
+
+	case len(parts) == 2 && parts[1] == "deliveries":
+		if r.Method != "GET" {
+			methodNotAllowed(w, r, "GET")
+			return
+		}
+		list, err := webhooks.Deliveries(id)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+
+	case len(parts) == 4 && parts[1] == "deliveries" && parts[3] == "redeliver":
+		if r.Method != "POST" {
+			methodNotAllowed(w, r, "POST")
+			return
+		}
+		deliveryID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid delivery ID")
+			return
+		}
+		d, err := webhooks.Redeliver(id, deliveryID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(d)
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// writeWebhookError maps WebhookRegistry errors to HTTP status codes
+func writeWebhookError(w http.ResponseWriter, err error) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrDeliveryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookEndpoint records the requests it receives and answers each with
+// the next of its statuses, repeating the last.
+type webhookEndpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	times    []time.Time
+}
+
+func startWebhookEndpoint(t *testing.T, statuses ...int) (*webhookEndpoint, *httptest.Server) {
+	t.Helper()
+	e := &webhookEndpoint{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		status := e.statuses[min(len(e.requests), len(e.statuses)-1)]
+		e.requests = append(e.requests, r)
+		e.bodies = append(e.bodies, body)
+		e.times = append(e.times, time.Now())
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return e, srv
+}
+
+// waitForDelivery waits until the webhook's latest delivery is no longer
+// pending and returns it.
+func waitForDelivery(t *testing.T, hookID int) WebhookDelivery {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		list, err := webhooks.Deliveries(hookID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) > 0 && list[0].Status != DeliveryPending {
+			return list[0]
+		}
+	}
+	t.Fatalf("delivery to webhook %d still pending", hookID)
+	return WebhookDelivery{}
+}
+
+func TestWebhookSignedHeaders(t *testing.T) {
+	newTestStore(t)
+	taskManager.Subscribe(webhooks.Notify)
+	go webhooks.Run()
+	e, srv := startWebhookEndpoint(t, http.StatusOK)
+	hook, err := webhooks.Create(Webhook{URL: srv.URL, Secret: "webhook-secret", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTask(t, context.Background(), Task{Title: "Fix the gate"})
+	d := waitForDelivery(t, hook.ID)
+	if d.Status != DeliveryDelivered {
+		t.Fatalf("delivery = %+v, want delivered", d)
+	}
+
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(e.bodies[0])
+	for _, tt := range []struct{ header, want string }{
+		{"Content-Type", "application/json"},
+		{"X-Liz-Event", EventTaskCreated},
+		{"X-Liz-Delivery", "1"},
+		{signatureHeader, "sha256=" + hex.EncodeToString(mac.Sum(nil))},
+	} {
+		if got := e.requests[0].Header.Get(tt.header); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetrySchedule(t *testing.T) {
+	newTestStore(t)
+	delays := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}
+	t.Cleanup(func() { webhookRetryDelays = delays })
+	event := TaskEvent{Action: ActionCreated, TaskID: 1, At: time.Now(), Task: &Task{ID: 1, Title: "Fix the gate"}}
+
+	tests := []struct {
+		name     string
+		statuses []int
+		status   string
+		attempts int
+	}{
+		{"answered at once", []int{http.StatusNoContent}, DeliveryDelivered, 1},
+		{"answered on a retry", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}, DeliveryDelivered, 3},
+		{"never answered", []int{http.StatusInternalServerError}, DeliveryFailed, len(webhookRetryDelays) + 1},
+	}
+	for _, tt := range tests {
+		e, srv := startWebhookEndpoint(t, tt.statuses...)
+		hook, err := webhooks.Create(Webhook{URL: srv.URL, Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		webhooks.queue([]TaskEvent{event})
+		d := waitForDelivery(t, hook.ID)
+		if d.Status != tt.status || d.Attempts != tt.attempts {
+			t.Errorf("%s: delivery %s after %d attempts, want %s after %d", tt.name, d.Status, d.Attempts, tt.status, tt.attempts)
+		}
+		// Retries are timed from just before the last attempt was sent, so
+		// the endpoint may see them a little closer than the delay
+		e.mu.Lock()
+		for i := 1; i < len(e.times); i++ {
+			if wait := e.times[i].Sub(e.times[i-1]); wait < webhookRetryDelays[i-1]*3/4 {
+				t.Errorf("%s: retry %d after %v, want at least %v", tt.name, i, wait, webhookRetryDelays[i-1])
+			}
+		}
+		e.mu.Unlock()
+		if err := webhooks.Delete(hook.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
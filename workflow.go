@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkflowStatus is a column of the task board. Tasks in a Done column
+// are completed; tasks in any other column are not.
+type WorkflowStatus struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Done bool   `json:"done,omitempty"`
+}
+
+// defaultWorkflow is used until the workflow is first saved.
+var defaultWorkflow = []WorkflowStatus{
+	{ID: "todo", Name: "Todo"},
+	{ID: "in_progress", Name: "In Progress"},
+	{ID: "waiting", Name: "Waiting"},
+	{ID: "done", Name: "Done", Done: true},
+}
+
+var workflowIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ErrStatusInUse is returned when a new workflow leaves out a status that
+// tasks are still in, or changes whether it is done.
+var ErrStatusInUse = errors.New("workflow status is still in use")
+
+// Workflow holds the board columns, in order.
+type Workflow struct {
+	mu       sync.RWMutex
+	store    Store
+	statuses []WorkflowStatus
+}
+
+// workflow holds the board columns
+var workflow *Workflow
+
+// NewWorkflow loads the workflow from store, starting with the default
+// columns if none have been saved.
+func NewWorkflow(store Store) (*Workflow, error) {
+	list := []WorkflowStatus{}
+	found, err := store.Load("workflow", &list)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		list = slices.Clone(defaultWorkflow)
+	}
+	return &Workflow{store: store, statuses: list}, nil
+}
+
+// Statuses returns the columns in order.
+func (w *Workflow) Statuses() []WorkflowStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return slices.Clone(w.statuses)
+}
+
+// Lookup returns the status with the given ID.
+func (w *Workflow) Lookup(id string) (WorkflowStatus, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	i := slices.IndexFunc(w.statuses, func(s WorkflowStatus) bool { return s.ID == id })
+	if i < 0 {
+		return WorkflowStatus{}, false
+	}
+	return w.statuses[i], true
+}
+
+// Initial returns the first column whose Done flag matches completed: where
+// new tasks start, and where completed or reopened tasks go when they are
+// not moved anywhere in particular.
+func (w *Workflow) Initial(completed bool) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, s := range w.statuses {
+		if s.Done == completed {
+			return s.ID
+		}
+	}
+	return ""
+}
+
+// Replace saves a new list of columns. Statuses that tasks are in may be
+// renamed or reordered, but not left out or moved between done and not
+// done, which would leave their tasks' Completed flags out of step.
+func (w *Workflow) Replace(list []WorkflowStatus, inUse map[string]int) ([]WorkflowStatus, error) {
+	if err := validateWorkflow(list); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, n := range inUse {
+		if n == 0 {
+			continue
+		}
+		i := slices.IndexFunc(list, func(s WorkflowStatus) bool { return s.ID == id })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: tasks are still in %q", ErrStatusInUse, id)
+		}
+		if old := slices.IndexFunc(w.statuses, func(s WorkflowStatus) bool { return s.ID == id }); old >= 0 && w.statuses[old].Done != list[i].Done {
+			return nil, fmt.Errorf("%w: move the tasks out of %q before changing whether it is done", ErrStatusInUse, id)
+		}
+	}
+	if err := w.store.Save("workflow", list); err != nil {
+		return nil, err
+	}
+	w.statuses = slices.Clone(list)
+	return list, nil
+}
+
+// settleStatus keeps a task's workflow status and Completed flag in step
+// after a change. A status the change set wins; otherwise the status
+// follows Completed. A task that lands in a new column goes to its end.
+// before is nil for new tasks.
+func settleStatus(tasks []Task, before *Task, task *Task) {
+	if task.WorkflowStatus == "" && before != nil {
+		task.WorkflowStatus = before.WorkflowStatus
+	}
+	status, known := workflow.Lookup(task.WorkflowStatus)
+	moved := before == nil || task.WorkflowStatus != before.WorkflowStatus
+	switch {
+	case known && moved && task.WorkflowStatus != "":
+		task.Completed = status.Done
+	case !known || status.Done != task.Completed:
+		task.WorkflowStatus = workflow.Initial(task.Completed)
+	}
+	if before == nil || task.WorkflowStatus != before.WorkflowStatus {
+		task.Position = endOfColumn(tasks, task.WorkflowStatus)
+	}
+}
+
+// endOfColumn returns the position after the last task in a column.
+func endOfColumn(tasks []Task, status string) int {
+	end := 1
+	for _, t := range tasks {
+		if t.WorkflowStatus == status {
+			end = max(end, t.Position+1)
+		}
+	}
+	return end
+}
+
+// Move puts a task into a workflow status at position (0 is the top of the
+// column), completing or reopening it to match. Other tasks in the column
+// shift to make room; that is not a change to them, so their versions stay
+// the same. If version is non-zero it must match the stored version.
+func (m *TaskManager) Move(ctx context.Context, id int, status string, position, version int) (Task, error) {
+	if _, ok := workflow.Lookup(status); !ok {
+		return Task{}, &ValidationError{Fields: []FieldError{{Field: "status", Message: fmt.Sprintf("unknown workflow status %q", status)}}}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(id)
+	if i < 0 {
+		return Task{}, ErrTaskNotFound
+	}
+	current := m.tasks[i]
+	if version != 0 && version != current.Version {
+		return Task{}, ErrVersionConflict
+	}
+
+	task := current
+	task.WorkflowStatus = status
+	settleStatus(m.tasks, &current, &task)
+	now := time.Now()
+	if task.Completed && !current.Completed {
+		task.CompletedAt = &now
+	} else if !task.Completed {
+		task.CompletedAt = nil
+	}
+	if err := authorizeTaskChange(ctx, &current, &task); err != nil {
+		return Task{}, err
+	}
+	if err := checkCompletable(ctx, m.tasks, current, task); err != nil {
+		return Task{}, err
+	}
+	changed := len(diffTasks(&current, &task)) > 0
+	if changed {
+		task.Version++
+	}
+
+	tasks := slices.Clone(m.tasks)
+	tasks, nextID, next := m.scheduleNext(&task, tasks, m.nextID)
+	tasks[i] = task
+
+	// Renumber the column with the task at its new place
+	var column []int
+	for j, t := range tasks {
+		if t.WorkflowStatus == status && t.ID != id {
+			column = append(column, j)
+		}
+	}
+	sort.SliceStable(column, func(a, b int) bool { return tasks[column[a]].Position < tasks[column[b]].Position })
+	position = min(max(position, 0), len(column))
+	column = slices.Insert(column, position, i)
+	for n, j := range column {
+		tasks[j].Position = n + 1
+	}
+	task = tasks[i]
+
+	parents := completeParents(tasks, id, now)
+	if err := m.commit(tasks, nextID); err != nil {
+		return Task{}, err
+	}
+	if changed {
+		m.emit(ctx, ActionUpdated, &current, &task)
+	}
+	if next != nil {
+		m.emit(ctx, ActionCreated, nil, next)
+	}
+	for _, p := range parents {
+		m.emit(ctx, ActionToggled, &p[0], &p[1])
+	}
+	return task, nil
+}
+
+// ReplaceWorkflow saves new board columns, checking them against the
+// tasks in each column. It holds m.mu throughout so no task can be moved
+// into a column while it is being removed.
+func (m *TaskManager) ReplaceWorkflow(list []WorkflowStatus) ([]WorkflowStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, t := range m.tasks {
+		counts[t.WorkflowStatus]++
+	}
+	return workflow.Replace(list, counts)
+}
+
+// moveHandler serves POST /api/tasks/{id}/move with a body such as
+// {"status": "in_progress", "position": 0}.
+func moveHandler(w http.ResponseWriter, r *http.Request, taskID int) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !requireTaskAccess(w, r, taskID) {
+		return
+	}
+	var body struct {
+		Status   string `json:"status"`
+		Position int    `json:"position"`
+		Version  int    `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+	version := body.Version
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var err error
+		if version, err = parseETag(ifMatch); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid If-Match header")
+			return
+		}
+	}
+
+	task, err := taskManager.Move(completionContext(r), taskID, body.Status, body.Position, version)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	setETag(w, task)
+	json.NewEncoder(w).Encode(viewTask(task, time.Now()))
+}
+
+// workflowHandler serves /api/workflow. Everyone may read the board's
+// columns; replacing them needs PermManageWorkflow.
+func workflowHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(workflow.Statuses())
+
+	case "PUT":
+		if !requirePermission(w, r, PermManageWorkflow) {
+			return
+		}
+		var list []WorkflowStatus
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		for i := range list {
+			list[i].ID = strings.TrimSpace(list[i].ID)
+			list[i].Name = strings.TrimSpace(list[i].Name)
+		}
+		list, err := taskManager.ReplaceWorkflow(list)
+		if err != nil {
+			var invalid *ValidationError
+			switch {
+			case errors.As(err, &invalid):
+				writeValidationError(w, invalid)
+			case errors.Is(err, ErrStatusInUse):
+				writeError(w, http.StatusConflict, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+
+	default:
+		methodNotAllowed(w, r, "GET", "PUT")
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// zohoPageSize is the most records Zoho CRM returns per page.
+	zohoPageSize = 200
+	// zohoTimeout limits each request to Zoho.
+	zohoTimeout = 30 * time.Second
+	// zohoTimeFormat is how Zoho CRM writes date-times.
+	zohoTimeFormat = "2006-01-02T15:04:05-07:00"
+)
+
+// ErrZohoUnauthorized is returned when Zoho rejects the OAuth credentials.
+var ErrZohoUnauthorized = errors.New("Zoho rejected the OAuth credentials")
+
+// ZohoClient calls the Zoho CRM REST API (v2 and later) with a
+// self-client refresh token. AccountsURL and APIDomain can point at a mock
+// server for testing.
+type ZohoClient struct {
+	AccountsURL  string // e.g. https://accounts.zoho.com; .eu, .in etc. for other data centres
+	APIDomain    string // e.g. https://www.zohoapis.com
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+
+	http    *http.Client
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewZohoClient returns a client for the given OAuth credentials.
+func NewZohoClient(accountsURL, apiDomain, clientID, clientSecret, refreshToken string) *ZohoClient {
+	return &ZohoClient{
+		AccountsURL:  strings.TrimRight(accountsURL, "/"),
+		APIDomain:    strings.TrimRight(apiDomain, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RefreshToken: refreshToken,
+		http:         &http.Client{Timeout: zohoTimeout},
+	}
+}
+
+// zohoError is the error body Zoho sends with failed requests.
+type zohoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error"` // OAuth endpoint errors
+}
+
+// accessToken returns a current OAuth access token, refreshing it if it has
+// expired or force is set.
+func (c *ZohoClient) accessToken(force bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !force && c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"refresh_token": {c.RefreshToken},
+	}
+	resp, err := c.http.PostForm(c.AccountsURL+"/oauth/v2/token", form)
+	if err != nil {
+		return "", fmt.Errorf("refreshing Zoho token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // seconds
+		APIDomain   string `json:"api_domain"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("refreshing Zoho token: %s", resp.Status)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("%w: %s", ErrZohoUnauthorized, valueOr(body.Error, resp.Status))
+	}
+	c.token = body.AccessToken
+	// Renew a minute early rather than have a request fail
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	if c.APIDomain == "" && body.APIDomain != "" {
+		c.APIDomain = strings.TrimRight(body.APIDomain, "/")
+	}
+	return c.token, nil
+}
+
+// get sends an authorised GET and decodes the JSON response into out. It
+// reports false, without an error, when Zoho answers 204 No Content or 304
+// Not Modified. An expired token is refreshed and the request retried once.
+func (c *ZohoClient) get(path string, params url.Values, header http.Header, out any) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(attempt > 0)
+		if err != nil {
+			return false, err
+		}
+		req, err := http.NewRequest("GET", c.APIDomain+path+"?"+params.Encode(), nil)
+		if err != nil {
+			return false, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Authorization", "Zoho-oauthtoken "+token)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return false, err
+		}
+		found, retry, err := decodeZohoResponse(resp, out)
+		resp.Body.Close()
+		if retry && attempt == 0 {
+			continue
+		}
+		if retry {
+			return false, ErrZohoUnauthorized
+		}
+		return found, err
+	}
+}
+
+// decodeZohoResponse reads a Zoho API response into out. retry is set when
+// the access token was rejected.
+func decodeZohoResponse(resp *http.Response, out any) (found, retry bool, err error) {
+	switch {
+	case resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusNotModified:
+		return false, false, nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		return false, true, nil
+	case resp.StatusCode >= 300:
+		var e zohoError
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, &e) == nil && e.Code != "" {
+			return false, false, fmt.Errorf("Zoho answered %s: %s %s", resp.Status, e.Code, e.Message)
+		}
+		return false, false, fmt.Errorf("Zoho answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, false, fmt.Errorf("reading Zoho response: %w", err)
+	}
+	return true, false, nil
+}
+
+// ZohoRecord is one CRM record: field API names to values.
+type ZohoRecord map[string]any
+
+// String returns a field as text. Lookup fields, which Zoho sends as
+// {"name": ..., "id": ...}, give their name.
+func (r ZohoRecord) String(field string) string {
+	switch v := r[field].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]any:
+		if name, ok := v["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Records calls fn with each page of records in a module, in order of
+// modification. With since set, only records modified after it are fetched.
+func (c *ZohoClient) Records(module string, fields []string, since time.Time, fn func([]ZohoRecord) error) error {
+	header := http.Header{}
+	if !since.IsZero() {
+		header.Set("If-Modified-Since", since.Format(zohoTimeFormat))
+	}
+	for page := 1; ; page++ {
+		params := url.Values{
+			"page":       {strconv.Itoa(page)},
+			"per_page":   {strconv.Itoa(zohoPageSize)},
+			"fields":     {strings.Join(fields, ",")},
+			"sort_by":    {"Modified_Time"},
+			"sort_order": {"asc"},
+		}
+		var body struct {
+			Data []ZohoRecord `json:"data"`
+			Info struct {
+				MoreRecords bool `json:"more_records"`
+			} `json:"info"`
+		}
+		found, err := c.get("/crm/v2/"+url.PathEscape(module), params, header, &body)
+		if err != nil || !found {
+			return err
+		}
+		if err := fn(body.Data); err != nil {
+			return err
+		}
+		if !body.Info.MoreRecords {
+			return nil
+		}
+	}
+}
+
+// ErrZohoNotConfigured is returned when syncing without OAuth credentials.
+var ErrZohoNotConfigured = errors.New("the Zoho integration has no OAuth credentials")
+
+// ZohoFields names the Zoho CRM fields (API names) resident details are
+// read from. An empty name leaves that detail blank.
+type ZohoFields struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Unit    string `json:"unit"`
+	Status  string `json:"status"`
+	MoveIn  string `json:"move_in"`
+	MoveOut string `json:"move_out"`
+}
+
+// list returns the API names to request, with Modified_Time for
+// incremental syncs.
+func (f ZohoFields) list() []string {
+	names := []string{"Modified_Time"}
+	for _, name := range []string{f.Name, f.Email, f.Phone, f.Unit, f.Status, f.MoveIn, f.MoveOut} {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ZohoConfig says where residents are pulled from. The client secret and
+// refresh token can be set but are never returned by the API.
+type ZohoConfig struct {
+	AccountsURL  string     `json:"accounts_url"`
+	APIDomain    string     `json:"api_domain"`
+	ClientID     string     `json:"client_id"`
+	ClientSecret string     `json:"client_secret,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Module       string     `json:"module"`
+	Fields       ZohoFields `json:"fields"`
+	// CurrentStatuses are the values of the status field that mean someone
+	// still lives at the property. Residents without a status are current
+	// until their move-out date.
+	CurrentStatuses []string `json:"current_statuses"`
+	// SyncMinutes is how often residents are pulled; 0 syncs only on request.
+	SyncMinutes int `json:"sync_minutes"`
+}
+
+func defaultZohoConfig() ZohoConfig {
+	return ZohoConfig{
+		AccountsURL: "https://accounts.zoho.com",
+		APIDomain:   "https://www.zohoapis.com",
+		Module:      "Contacts",
+		Fields: ZohoFields{
+			Name:    "Full_Name",
+			Email:   "Email",
+			Phone:   "Phone",
+			Unit:    "Unit",
+			Status:  "Resident_Status",
+			MoveIn:  "Move_In_Date",
+			MoveOut: "Move_Out_Date",
+		},
+		CurrentStatuses: []string{"Current"},
+	}
+}
+
+// configured reports whether there are credentials to sync with.
+func (c ZohoConfig) configured() bool {
+	return c.ClientID != "" && c.ClientSecret != "" && c.RefreshToken != ""
+}
+
+// client returns a Zoho client for the settings, or nil if there are no
+// credentials.
+func (c ZohoConfig) client() *ZohoClient {
+	if !c.configured() {
+		return nil
+	}
+	return NewZohoClient(c.AccountsURL, c.APIDomain, c.ClientID, c.ClientSecret, c.RefreshToken)
+}
+
+// resident reads a CRM record using the field mapping.
+func (c ZohoConfig) resident(record ZohoRecord) Resident {
+	f := c.Fields
+	res := Resident{
+		ID:      record.String("id"),
+		Name:    strings.TrimSpace(record.String(f.Name)),
+		Email:   record.String(f.Email),
+		Phone:   record.String(f.Phone),
+		Unit:    record.String(f.Unit),
+		Status:  record.String(f.Status),
+		MoveIn:  zohoDate(record.String(f.MoveIn)),
+		MoveOut: zohoDate(record.String(f.MoveOut)),
+	}
+	if t, err := time.Parse(zohoTimeFormat, record.String("Modified_Time")); err == nil {
+		res.ModifiedAt = t
+	}
+	if res.Name == "" {
+		res.Name = res.ID
+	}
+	return res
+}
+
+// zohoDate reduces a Zoho date or date-time to YYYY-MM-DD, or "" if it is
+// neither.
+func zohoDate(value string) string {
+	if len(value) < 10 {
+		return ""
+	}
+	if _, err := time.Parse("2006-01-02", value[:10]); err != nil {
+		return ""
+	}
+	return value[:10]
+}
+
+// SyncResult says what a sync changed.
+type SyncResult struct {
+	At      time.Time `json:"at"`
+	Full    bool      `json:"full"`
+	Fetched int       `json:"fetched"`
+	Added   int       `json:"added"`
+	Updated int       `json:"updated"`
+	Removed int       `json:"removed"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// zohoState is what the integration keeps in the store.
+type zohoState struct {
+	Config ZohoConfig `json:"config"`
+	// Since is the latest Modified_Time synced; the next incremental sync
+	// asks only for records changed after it.
+	Since    time.Time   `json:"since"`
+	LastSync *SyncResult `json:"last_sync,omitempty"`
+}
+
+// ZohoConfig returns the sync settings without secrets, whether
+// credentials are set, and the outcome of the last sync.
+func (r *ResidentRegistry) ZohoConfig() (config ZohoConfig, configured bool, last *SyncResult) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	config = r.zoho.Config
+	configured = config.configured()
+	config.ClientSecret, config.RefreshToken = "", ""
+	config.CurrentStatuses = slices.Clone(config.CurrentStatuses)
+	return config, configured, r.zoho.LastSync
+}
+
+// SetZohoConfig saves new sync settings, keeping the client secret and
+// refresh token if none are given. Changing the module or fields makes
+// the next sync fetch every record again.
+func (r *ResidentRegistry) SetZohoConfig(config ZohoConfig) error {
+	if err := validateZohoConfig(config); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.zoho.Config
+	config.ClientSecret = valueOr(config.ClientSecret, current.ClientSecret)
+	config.RefreshToken = valueOr(config.RefreshToken, current.RefreshToken)
+	if config.CurrentStatuses == nil {
+		config.CurrentStatuses = []string{}
+	}
+	state := r.zoho
+	state.Config = config
+	if config.Module != current.Module || config.Fields != current.Fields {
+		state.Since = time.Time{}
+	}
+	if err := r.store.Save("zoho", state); err != nil {
+		return err
+	}
+	r.zoho = state
+	r.client = config.client()
+	return nil
+}
+
+// Sync pulls residents from Zoho CRM: those changed since the last sync,
+// or with full set every record, marking residents no longer in Zoho as
+// removed. Only one sync runs at a time.
+func (r *ResidentRegistry) Sync(full bool) (SyncResult, error) {
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+
+	r.mu.RLock()
+	config, client, since := r.zoho.Config, r.client, r.zoho.Since
+	r.mu.RUnlock()
+	if client == nil {
+		return SyncResult{}, ErrZohoNotConfigured
+	}
+	if full {
+		since = time.Time{}
+	}
+
+	result := SyncResult{At: time.Now(), Full: full}
+	fetched := map[string]Resident{}
+	var order []string
+	err := client.Records(config.Module, config.Fields.list(), since, func(records []ZohoRecord) error {
+		for _, record := range records {
+			res := config.resident(record)
+			if res.ID == "" {
+				continue
+			}
+			res.SyncedAt = result.At
+			if _, seen := fetched[res.ID]; !seen {
+				order = append(order, res.ID)
+			}
+			fetched[res.ID] = res
+			if res.ModifiedAt.After(since) {
+				since = res.ModifiedAt
+			}
+		}
+		return nil
+	})
+	result.Fetched = len(fetched)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.zoho
+	if err != nil {
+		result.Error = err.Error()
+		state.LastSync = &result
+		if saveErr := r.store.Save("zoho", state); saveErr == nil {
+			r.zoho = state
+		}
+		return result, err
+	}
+
+	list := slices.Clone(r.residents)
+	for i, old := range list {
+		res, ok := fetched[old.ID]
+		switch {
+		case ok:
+			if !sameResident(old, res) {
+				result.Updated++
+			}
+			list[i] = res
+			delete(fetched, old.ID)
+		case full && !old.Removed:
+			list[i].Removed = true
+			list[i].SyncedAt = result.At
+			result.Removed++
+		}
+	}
+	for _, id := range order {
+		if res, ok := fetched[id]; ok {
+			list = append(list, res)
+			result.Added++
+		}
+	}
+	if err := r.store.Save("residents", list); err != nil {
+		return result, err
+	}
+	r.residents = list
+	state.Since = since
+	state.LastSync = &result
+	if err := r.store.Save("zoho", state); err != nil {
+		return result, err
+	}
+	r.zoho = state
+	return result, nil
+}
+
+// sameResident reports whether a synced record differs from what was
+// stored only in when it was synced.
+func sameResident(a, b Resident) bool {
+	if !a.ModifiedAt.Equal(b.ModifiedAt) {
+		return false
+	}
+	a.ModifiedAt, a.SyncedAt = b.ModifiedAt, b.SyncedAt
+	return a == b
+}
+
+// RunSync pulls changed residents every SyncMinutes until the process
+// exits. The interval is read each minute so new settings apply without
+// a restart.
+func (r *ResidentRegistry) RunSync() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.mu.RLock()
+		minutes, last := r.zoho.Config.SyncMinutes, r.zoho.LastSync
+		r.mu.RUnlock()
+		if minutes == 0 || (last != nil && now.Sub(last.At) < time.Duration(minutes)*time.Minute) {
+			continue
+		}
+		if _, err := r.Sync(false); err != nil && !errors.Is(err, ErrZohoNotConfigured) {
+			log.Printf("zoho: %v", err)
+		}
+	}
+}
+
+// zohoConfigHandler serves /api/integrations/zoho/config, the resident
+// sync settings. The client secret and refresh token can be set but not
+// read back.
+func zohoConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requirePermission(w, r, PermManageIntegrations) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var config ZohoConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		config.ClientSecret = strings.TrimSpace(config.ClientSecret)
+		config.RefreshToken = strings.TrimSpace(config.RefreshToken)
+		if err := residents.SetZohoConfig(config); err != nil {
+			var invalid *ValidationError
+			if errors.As(err, &invalid) {
+				writeValidationError(w, invalid)
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+	default:
+		methodNotAllowed(w, r, "GET", "PUT")
+		return
+	}
+	config, configured, last := residents.ZohoConfig()
+	json.NewEncoder(w).Encode(struct {
+		ZohoConfig
+		Configured bool        `json:"configured"`
+		LastSync   *SyncResult `json:"last_sync,omitempty"`
+	}{config, configured, last})
+}
+
+// zohoSyncHandler serves POST /api/integrations/zoho/sync, which pulls
+// changed residents now, or every resident with full=true.
+func zohoSyncHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requirePermission(w, r, PermManageIntegrations) {
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+
+	full := r.URL.Query().Get("full") == "true"
+	result, err := residents.Sync(full)
+	switch {
+	case errors.Is(err, ErrZohoNotConfigured):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil && result.Error != "":
+		writeError(w, http.StatusBadGateway, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		json.NewEncoder(w).Encode(result)
+	}
+}
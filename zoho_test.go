@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeZoho serves the OAuth token endpoint and one CRM module, a few
+// records per page.
+type fakeZoho struct {
+	mu        sync.Mutex
+	records   []ZohoRecord // in order of modification
+	pageSize  int
+	token     string
+	refreshes int
+	sinces    []string // If-Modified-Since of each first page requested
+}
+
+func startFakeZoho(t *testing.T) (*fakeZoho, *httptest.Server) {
+	t.Helper()
+	f := &fakeZoho{pageSize: 2}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/v2/token", f.serveToken)
+	mux.HandleFunc("GET /crm/v2/Contacts", f.serveRecords)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeZoho) serveToken(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.PostFormValue("refresh_token") != "refresh" || r.PostFormValue("client_secret") != "secret" {
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_code"})
+		return
+	}
+	f.refreshes++
+	f.token = fmt.Sprintf("token-%d", f.refreshes)
+	json.NewEncoder(w).Encode(map[string]any{"access_token": f.token, "expires_in": 3600})
+}
+
+func (f *fakeZoho) serveRecords(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Zoho-oauthtoken "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(zohoError{Code: "INVALID_TOKEN", Message: "invalid oauth token"})
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page == 1 {
+		f.sinces = append(f.sinces, r.Header.Get("If-Modified-Since"))
+	}
+	records := f.records
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := time.Parse(zohoTimeFormat, header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records = slices.DeleteFunc(slices.Clone(records), func(record ZohoRecord) bool {
+			modified, _ := time.Parse(zohoTimeFormat, record.String("Modified_Time"))
+			return !modified.After(since)
+		})
+	}
+	start := (page - 1) * f.pageSize
+	if start >= len(records) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	end := min(start+f.pageSize, len(records))
+	json.NewEncoder(w).Encode(map[string]any{
+		"data": records[start:end],
+		"info": map[string]any{"page": page, "more_records": end < len(records)},
+	})
+}
+
+// put adds or changes a record, modified at the given time.
+func (f *fakeZoho) put(id, name, status string, modified time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = slices.DeleteFunc(f.records, func(record ZohoRecord) bool { return record["id"] == id })
+	f.records = append(f.records, ZohoRecord{
+		"id":              id,
+		"Full_Name":       name,
+		"Resident_Status": status,
+		"Modified_Time":   modified.Format(zohoTimeFormat),
+	})
+}
+
+func (f *fakeZoho) remove(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = slices.DeleteFunc(f.records, func(record ZohoRecord) bool { return record["id"] == id })
+}
+
+// revoke makes the current access token invalid, as when it expires early.
+func (f *fakeZoho) revoke() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = "revoked"
+}
+
+// counts returns how often the token was refreshed and the
+// If-Modified-Since of each sync so far.
+func (f *fakeZoho) counts() (refreshes int, sinces []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refreshes, slices.Clone(f.sinces)
+}
+
+// newZohoResidents returns a resident registry syncing from srv.
+func newZohoResidents(t *testing.T, srv *httptest.Server, refreshToken string) *ResidentRegistry {
+	t.Helper()
+	newTestStore(t)
+	config := defaultZohoConfig()
+	config.AccountsURL, config.APIDomain = srv.URL, srv.URL
+	config.ClientID, config.ClientSecret, config.RefreshToken = "client", "secret", refreshToken
+	if err := residents.SetZohoConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return residents
+}
+
+func residentIDs(r *ResidentRegistry, removed bool) []string {
+	var ids []string
+	for _, res := range r.List() {
+		if res.Removed == removed {
+			ids = append(ids, res.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+var zohoEpoch = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+func TestZohoSyncPagesAndRefreshesToken(t *testing.T) {
+	f, srv := startFakeZoho(t)
+	for i := 1; i <= 5; i++ {
+		f.put(strconv.Itoa(i), fmt.Sprintf("Resident %d", i), "Current", zohoEpoch.Add(time.Duration(i)*time.Minute))
+	}
+	r := newZohoResidents(t, srv, "refresh")
+
+	result, err := r.Sync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Fetched != 5 || result.Added != 5 {
+		t.Errorf("sync fetched %d and added %d, want 5 and 5", result.Fetched, result.Added)
+	}
+	if got := residentIDs(r, false); fmt.Sprint(got) != "[1 2 3 4 5]" {
+		t.Errorf("residents = %v, want all 5 across 3 pages", got)
+	}
+	if refreshes, _ := f.counts(); refreshes != 1 {
+		t.Errorf("token refreshed %d times, want 1", refreshes)
+	}
+
+	// A rejected token is refreshed and the request retried
+	f.revoke()
+	f.put("6", "Resident 6", "Current", zohoEpoch.Add(time.Hour))
+	if _, err := r.Sync(false); err != nil {
+		t.Fatal(err)
+	}
+	if refreshes, _ := f.counts(); refreshes != 2 {
+		t.Errorf("token refreshed %d times after being revoked, want 2", refreshes)
+	}
+	if _, err := r.Get("6"); err != nil {
+		t.Errorf("resident added after the retry: %v", err)
+	}
+}
+
+func TestZohoSyncRejectedCredentials(t *testing.T) {
+	_, srv := startFakeZoho(t)
+	r := newZohoResidents(t, srv, "wrong")
+
+	result, err := r.Sync(false)
+	if !errors.Is(err, ErrZohoUnauthorized) {
+		t.Fatalf("sync error = %v, want %v", err, ErrZohoUnauthorized)
+	}
+	if _, _, last := r.ZohoConfig(); last == nil || last.Error != result.Error {
+		t.Errorf("last sync = %+v, want the error recorded", last)
+	}
+}
+
+func TestZohoSyncNoRecords(t *testing.T) {
+	f, srv := startFakeZoho(t)
+	r := newZohoResidents(t, srv, "refresh")
+
+	// Zoho answers 204 No Content for a module without records
+	result, err := r.Sync(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Fetched != 0 || len(r.List()) != 0 {
+		t.Errorf("sync of an empty module = %+v with %d residents", result, len(r.List()))
+	}
+	if _, sinces := f.counts(); len(sinces) != 1 {
+		t.Errorf("requested %d first pages, want 1", len(sinces))
+	}
+}
+
+func TestZohoIncrementalSync(t *testing.T) {
+	f, srv := startFakeZoho(t)
+	f.put("1", "Ada Lane", "Current", zohoEpoch)
+	f.put("2", "Bo Ruiz", "Current", zohoEpoch.Add(time.Minute))
+	r := newZohoResidents(t, srv, "refresh")
+	if _, err := r.Sync(false); err != nil {
+		t.Fatal(err)
+	}
+
+	f.put("1", "Ada Lane", "Moved Out", zohoEpoch.Add(time.Hour))
+	result, err := r.Sync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, sinces := f.counts(); sinces[1] != zohoEpoch.Add(time.Minute).Format(zohoTimeFormat) {
+		t.Errorf("If-Modified-Since = %q, want the latest record synced", sinces[1])
+	}
+	if result.Fetched != 1 || result.Updated != 1 || result.Added != 0 {
+		t.Errorf("incremental sync = %+v, want 1 fetched and updated", result)
+	}
+	if res, _ := r.Get("1"); res.Status != "Moved Out" || res.Current {
+		t.Errorf("updated resident = %+v, want moved out", res)
+	}
+
+	// Nothing changed since: Zoho answers 204 and nothing is touched
+	result, err = r.Sync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Fetched != 0 || result.Updated != 0 {
+		t.Errorf("sync with no changes = %+v", result)
+	}
+	if len(r.List()) != 2 {
+		t.Errorf("incremental sync changed the residents: %+v", r.List())
+	}
+}
+
+func TestZohoFullSyncMarksRemoved(t *testing.T) {
+	f, srv := startFakeZoho(t)
+	for i := 1; i <= 3; i++ {
+		f.put(strconv.Itoa(i), fmt.Sprintf("Resident %d", i), "Current", zohoEpoch.Add(time.Duration(i)*time.Minute))
+	}
+	r := newZohoResidents(t, srv, "refresh")
+	if _, err := r.Sync(false); err != nil {
+		t.Fatal(err)
+	}
+
+	f.remove("2")
+	if _, err := r.Sync(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := residentIDs(r, true); len(got) != 0 {
+		t.Errorf("incremental sync removed %v; it cannot tell deletions", got)
+	}
+
+	result, err := r.Sync(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, sinces := f.counts(); result.Removed != 1 || sinces[len(sinces)-1] != "" {
+		t.Errorf("full sync = %+v with If-Modified-Since %q, want 1 removed and every record asked for", result, sinces[len(sinces)-1])
+	}
+	if got := residentIDs(r, true); fmt.Sprint(got) != "[2]" {
+		t.Errorf("removed residents = %v, want [2]", got)
+	}
+	// Removed residents are kept so tasks stay linked to them
+	if res, err := r.Get("2"); err != nil || res.Current {
+		t.Errorf("removed resident = %+v, %v; want kept and not current", res, err)
+	}
+
+	if result, _ := r.Sync(true); result.Removed != 0 {
+		t.Errorf("second full sync removed %d again", result.Removed)
+	}
+}